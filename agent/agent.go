@@ -0,0 +1,242 @@
+// Package agent runs conversations with an LLM while keeping track of the full
+// message history, which makes it possible to persist, restore and rewrite the
+// conversation between turns.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+type Agent struct {
+	// SystemPrompt is called before every request to the provider.
+	SystemPrompt func() content.Content
+
+	provider            llms.Provider
+	providerMiddlewares []func(llms.Provider) llms.Provider
+	tools               []tools.Tool
+	disabled            map[string]bool
+	middlewares         []func(tools.Tool) tools.Tool
+	debug               bool
+	compaction          *CompactOptions
+
+	llm *llms.LLM
+	// stale is true when the LLM needs to be recreated before the next turn,
+	// for example because the history was replaced.
+	stale bool
+
+	mu      sync.Mutex
+	history []llms.Message
+	usage   llms.Usage
+}
+
+func New(provider llms.Provider, tools ...tools.Tool) *Agent {
+	return &Agent{
+		provider: provider,
+		tools:    tools,
+		disabled: make(map[string]bool),
+		stale:    true,
+	}
+}
+
+func (a *Agent) WithDebug() *Agent {
+	a.debug = true
+	a.stale = true
+	return a
+}
+
+// Provider returns the provider that the agent was created with.
+func (a *Agent) Provider() llms.Provider {
+	return a.provider
+}
+
+// SetProvider switches to another provider (or model) for the following
+// turns, keeping the conversation so far.
+func (a *Agent) SetProvider(provider llms.Provider) {
+	a.provider = provider
+	a.stale = true
+}
+
+// AddTool makes another tool available to the LLM.
+func (a *Agent) AddTool(t tools.Tool) {
+	a.tools = append(a.tools, t)
+	if a.llm != nil {
+		a.llm.AddTool(a.wrap(t))
+	}
+}
+
+// Tools returns all the tools added to the agent, including disabled ones.
+func (a *Agent) Tools() []tools.Tool {
+	return slices.Clone(a.tools)
+}
+
+// SetToolEnabled enables or disables the tool with the given function name
+// for the following turns. Disabled tools aren't offered to the LLM at all.
+func (a *Agent) SetToolEnabled(name string, enabled bool) error {
+	if !slices.ContainsFunc(a.tools, func(t tools.Tool) bool { return t.FuncName() == name }) {
+		return fmt.Errorf("there is no tool named %q", name)
+	}
+	if a.disabled[name] == !enabled {
+		return nil
+	}
+	a.disabled[name] = !enabled
+	a.stale = true
+	return nil
+}
+
+// ToolEnabled reports whether the tool with the given function name is
+// offered to the LLM.
+func (a *Agent) ToolEnabled(name string) bool {
+	return !a.disabled[name]
+}
+
+// Usage returns the total number of tokens used by the agent so far.
+func (a *Agent) Usage() llms.Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.usage
+}
+
+func (a *Agent) addUsage(u llms.Usage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.usage.CachedInputTokens += u.CachedInputTokens
+	a.usage.InputTokens += u.InputTokens
+	a.usage.OutputTokens += u.OutputTokens
+}
+
+// Use adds a middleware that wraps every tool, for example to check
+// permissions before running it. Middlewares added later wrap earlier ones.
+func (a *Agent) Use(middleware func(tools.Tool) tools.Tool) {
+	a.middlewares = append(a.middlewares, middleware)
+	a.stale = true
+}
+
+// UseProvider adds a middleware that wraps the provider, for example to retry
+// failed requests. Middlewares added later wrap earlier ones.
+func (a *Agent) UseProvider(middleware func(llms.Provider) llms.Provider) {
+	a.providerMiddlewares = append(a.providerMiddlewares, middleware)
+	a.stale = true
+}
+
+func (a *Agent) wrapProvider(p llms.Provider) llms.Provider {
+	return &historyProvider{Provider: a.middlewareProvider(p), agent: a}
+}
+
+// middlewareProvider wraps the provider with the middlewares only, for
+// requests that aren't part of the conversation.
+func (a *Agent) middlewareProvider(p llms.Provider) llms.Provider {
+	for _, middleware := range a.providerMiddlewares {
+		p = middleware(p)
+	}
+	return p
+}
+
+func (a *Agent) wrap(t tools.Tool) tools.Tool {
+	for _, middleware := range a.middlewares {
+		t = middleware(t)
+	}
+	return t
+}
+
+// Messages returns a copy of the message history.
+func (a *Agent) Messages() []llms.Message {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.history)
+}
+
+// SetMessages replaces the message history, for example to restore a previous
+// session. It must not be called while a turn is running.
+func (a *Agent) SetMessages(messages []llms.Message) {
+	a.mu.Lock()
+	a.history = slices.Clone(messages)
+	a.mu.Unlock()
+	a.stale = true
+}
+
+func (a *Agent) setHistory(messages []llms.Message) {
+	a.mu.Lock()
+	a.history = messages
+	a.mu.Unlock()
+}
+
+// Chat sends the input to the LLM and returns a channel of updates, which is
+// closed when the turn is over. Call Err afterwards to check for failures.
+// Canceling ctx ends the turn early, keeping the history up to the last
+// complete response from the provider.
+func (a *Agent) Chat(ctx context.Context, input string) <-chan llms.Update {
+	updates := make(chan llms.Update)
+	go func() {
+		defer close(updates)
+		for update := range a.chat(ctx, input) {
+			updates <- update
+		}
+		if ctx.Err() != nil || a.llm.Err() != nil {
+			// The LLM's own history may have been left in the middle of a
+			// response, so start over from the recorded history next time.
+			a.stale = true
+		}
+	}()
+	return updates
+}
+
+func (a *Agent) chat(ctx context.Context, input string) <-chan llms.Update {
+	a.compactIfNeeded(ctx)
+	if !a.stale {
+		return a.llm.ChatWithContext(ctx, input)
+	}
+	a.llm = llms.New(a.wrapProvider(a.provider))
+	for _, t := range a.tools {
+		if !a.disabled[t.FuncName()] {
+			a.llm.AddTool(a.wrap(t))
+		}
+	}
+	a.llm.SystemPrompt = a.SystemPrompt
+	if a.debug {
+		a.llm.WithDebug()
+	}
+	a.stale = false
+	history := trimUnansweredToolCalls(a.Messages())
+	if len(history) == 0 {
+		return a.llm.ChatWithContext(ctx, input)
+	}
+	messages := append(history, llms.Message{Role: "user", Content: content.FromText(input)})
+	return a.llm.ChatUsingMessages(ctx, messages)
+}
+
+// Err returns the error that ended the last turn, if any.
+func (a *Agent) Err() error {
+	if a.llm == nil {
+		return nil
+	}
+	return a.llm.Err()
+}
+
+// trimUnansweredToolCalls drops trailing messages that contain tool calls
+// without results, which happens when a turn was interrupted while running
+// tools. Providers reject histories like that.
+func trimUnansweredToolCalls(messages []llms.Message) []llms.Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if len(messages[i].ToolCalls) == 0 {
+			continue
+		}
+		answered := 0
+		for _, m := range messages[i+1:] {
+			if m.ToolCallID != "" {
+				answered++
+			}
+		}
+		if answered < len(messages[i].ToolCalls) {
+			return messages[:i]
+		}
+		break
+	}
+	return messages
+}
@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+)
+
+// CompactOptions configures how the history is compacted once it gets long.
+type CompactOptions struct {
+	// MaxTokens is the estimated size of the history above which it's
+	// compacted before the next turn.
+	MaxTokens int
+	// KeepTurns is the number of most recent turns that are kept verbatim,
+	// unless they're too long by themselves. Then fewer turns are kept, and
+	// the tool results of a single turn that's over MaxTokens are truncated.
+	KeepTurns int
+	// MaxToolResultTokens is the estimated size above which tool results in
+	// older turns are truncated.
+	MaxToolResultTokens int
+	// OnCompact is called with the estimated size of the history when
+	// compaction starts, since summarizing takes a while.
+	OnCompact func(tokens int)
+}
+
+var DefaultCompactOptions = CompactOptions{
+	MaxTokens:           100_000,
+	KeepTurns:           4,
+	MaxToolResultTokens: 1_000,
+}
+
+// imageTokens is a rough estimate of what an image costs, which depends on
+// its size and the provider.
+const imageTokens = 1_600
+
+const summaryPrompt = `You are summarizing the earlier part of a conversation between a user and an AI assistant that helps with computer problems using tools such as running shell commands and reading files. The summary replaces those messages, so keep everything needed to continue the work: the user's goals, facts learned about their system (versions, paths, configuration, error messages), what was tried and what happened, decisions made, and anything still unresolved. Leave out pleasantries and raw output that no longer matters. Write it as concise notes.`
+
+// SetCompaction enables automatic compaction of the history with the given
+// options, or disables it if opts is nil.
+func (a *Agent) SetCompaction(opts *CompactOptions) {
+	a.compaction = opts
+}
+
+// Compact summarizes everything but the last turn now, regardless of the size
+// of the history. It returns the estimated size of the history before and
+// after. It must not be called while a turn is running.
+func (a *Agent) Compact(ctx context.Context) (before, after int, err error) {
+	opts := DefaultCompactOptions
+	if a.compaction != nil {
+		opts = *a.compaction
+	}
+	opts.MaxTokens = 0
+	opts.KeepTurns = 1
+	opts.OnCompact = nil
+	return a.compact(ctx, opts)
+}
+
+// compactIfNeeded compacts the history if it has grown past the limit.
+func (a *Agent) compactIfNeeded(ctx context.Context) {
+	if a.compaction == nil || a.compaction.MaxTokens <= 0 {
+		return
+	}
+	if EstimateTokens(a.Messages()) <= a.compaction.MaxTokens {
+		return
+	}
+	// If summarizing fails, the history is still shrunk as far as possible
+	// and the turn goes ahead; the provider will complain if it's too long.
+	a.compact(ctx, *a.compaction)
+}
+
+func (a *Agent) compact(ctx context.Context, opts CompactOptions) (before, after int, err error) {
+	history := trimUnansweredToolCalls(a.Messages())
+	before = EstimateTokens(history)
+	if opts.OnCompact != nil {
+		opts.OnCompact(before)
+	}
+	split := splitRecentTurns(history, opts.KeepTurns)
+	// A few long agentic turns can be over the limit by themselves, so keep
+	// fewer turns verbatim until the history fits.
+	for keep := opts.KeepTurns - 1; keep >= 1 && split > 0; keep-- {
+		shrunk := append(shrinkMessages(history[:split], opts.MaxToolResultTokens), history[split:]...)
+		if EstimateTokens(shrunk) <= opts.MaxTokens {
+			break
+		}
+		split = splitRecentTurns(history, keep)
+	}
+	old, recent := shrinkMessages(history[:split], opts.MaxToolResultTokens), history[split:]
+	if len(old) == 0 {
+		if EstimateTokens(recent) <= opts.MaxTokens {
+			return before, before, nil
+		}
+		// A single turn is over the limit. It's finished, so its tool results
+		// can be shrunk like those of older turns.
+		shrunk := shrinkMessages(recent, opts.MaxToolResultTokens)
+		a.SetMessages(shrunk)
+		return before, EstimateTokens(shrunk), nil
+	}
+	compacted := append(old, recent...)
+	if EstimateTokens(compacted) > opts.MaxTokens {
+		summary, summaryErr := a.summarize(ctx, old)
+		if summaryErr == nil {
+			compacted = append(summaryMessages(summary), recent...)
+		}
+		err = summaryErr
+	}
+	a.SetMessages(compacted)
+	return before, EstimateTokens(compacted), err
+}
+
+// summarize asks the provider for a summary of the messages.
+func (a *Agent) summarize(ctx context.Context, messages []llms.Message) (string, error) {
+	request := []llms.Message{{
+		Role:    "user",
+		Content: content.FromText("Summarize this conversation:\n\n" + transcript(messages)),
+	}}
+	stream := a.middlewareProvider(a.provider).Generate(ctx, content.FromText(summaryPrompt), request, nil, nil)
+	for range stream.Iter() {
+	}
+	a.addUsage(stream.Usage())
+	if err := stream.Err(); err != nil {
+		return "", fmt.Errorf("failed to summarize the conversation: %w", err)
+	}
+	summary := strings.TrimSpace(contentText(stream.Message().Content))
+	if summary == "" {
+		return "", fmt.Errorf("failed to summarize the conversation: empty summary")
+	}
+	return summary, nil
+}
+
+// summaryMessages creates the messages that stand in for the summarized part
+// of the conversation. Providers expect the history to start with a user
+// message and alternate roles, so the summary is acknowledged by the
+// assistant.
+func summaryMessages(summary string) []llms.Message {
+	return []llms.Message{
+		{Role: "user", Content: content.FromText("Earlier parts of our conversation were removed to save space. This is a summary of them:\n\n" + summary)},
+		{Role: "assistant", Content: content.FromText("Understood. I'll continue from there.")},
+	}
+}
+
+// splitRecentTurns returns the index of the message that starts the last
+// keepTurns turns, where a turn starts with a message from the user (as
+// opposed to a tool result).
+func splitRecentTurns(messages []llms.Message, keepTurns int) int {
+	if keepTurns <= 0 {
+		return len(messages)
+	}
+	turns := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" || messages[i].ToolCallID != "" {
+			continue
+		}
+		turns++
+		if turns >= keepTurns {
+			return i
+		}
+	}
+	return 0
+}
+
+// shrinkMessages returns a copy of the messages with images and thoughts
+// removed and long tool results truncated.
+func shrinkMessages(messages []llms.Message, maxToolResultTokens int) []llms.Message {
+	shrunk := make([]llms.Message, 0, len(messages))
+	for _, m := range messages {
+		m.Content = slices.Clone(m.Content)
+		m.Content = slices.DeleteFunc(m.Content, func(item content.Item) bool {
+			_, ok := item.(*content.Thought)
+			return ok
+		})
+		for i, item := range m.Content {
+			switch item := item.(type) {
+			case *content.ImageURL:
+				m.Content[i] = &content.Text{Text: "[An image was removed to save space.]"}
+			case *content.Text:
+				if m.ToolCallID != "" {
+					m.Content[i] = &content.Text{Text: truncateMiddle(item.Text, maxToolResultTokens*4)}
+				}
+			case *content.JSON:
+				if m.ToolCallID != "" && len(item.Data) > maxToolResultTokens*4 {
+					m.Content[i] = &content.Text{Text: truncateMiddle(string(item.Data), maxToolResultTokens*4)}
+				}
+			}
+		}
+		shrunk = append(shrunk, m)
+	}
+	return shrunk
+}
+
+// truncateMiddle keeps the start and end of s, which is where the interesting
+// parts of command output and files usually are.
+func truncateMiddle(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	head, tail := maxLen*2/3, maxLen/3
+	// Avoid cutting UTF-8 sequences in half.
+	for head > 0 && !isRuneStart(s[head]) {
+		head--
+	}
+	for tail > 0 && !isRuneStart(s[len(s)-tail]) {
+		tail--
+	}
+	return fmt.Sprintf("%s\n[... %d characters removed to save space ...]\n%s", s[:head], len(s)-head-tail, s[len(s)-tail:])
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// EstimateTokens roughly estimates the number of tokens the messages take up
+// in a request, assuming about four characters per token.
+func EstimateTokens(messages []llms.Message) int {
+	chars, images := 0, 0
+	for _, m := range messages {
+		for _, item := range m.Content {
+			switch item := item.(type) {
+			case *content.Text:
+				chars += len(item.Text)
+			case *content.JSON:
+				chars += len(item.Data)
+			case *content.Thought:
+				chars += len(item.Text)
+			case *content.ImageURL:
+				images++
+			}
+		}
+		for _, call := range m.ToolCalls {
+			chars += len(call.Name) + len(call.Arguments)
+		}
+	}
+	return chars/4 + images*imageTokens
+}
+
+// transcript renders the messages as plain text for summarizing.
+func transcript(messages []llms.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		role := m.Role
+		if m.ToolCallID != "" {
+			role = "tool result"
+		}
+		if text := contentText(m.Content); text != "" {
+			fmt.Fprintf(&sb, "%s: %s\n\n", role, text)
+		}
+		for _, call := range m.ToolCalls {
+			fmt.Fprintf(&sb, "%s called %s(%s)\n\n", role, call.Name, call.Arguments)
+		}
+	}
+	return sb.String()
+}
+
+// contentText returns the text in c, skipping thoughts and images.
+func contentText(c content.Content) string {
+	var parts []string
+	for _, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			parts = append(parts, item.Text)
+		case *content.JSON:
+			parts = append(parts, string(item.Data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
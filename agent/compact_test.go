@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+)
+
+func text(role, s string) llms.Message {
+	return llms.Message{Role: role, Content: content.FromText(s)}
+}
+
+func TestSplitRecentTurns(t *testing.T) {
+	messages := []llms.Message{
+		text("user", "first"),
+		{Role: "assistant", ToolCalls: []llms.ToolCall{{ID: "1", Name: "run_shell_cmd"}}},
+		{Role: "user", ToolCallID: "1", Content: content.FromText("output")},
+		text("assistant", "done"),
+		text("user", "second"),
+		text("assistant", "ok"),
+	}
+	if i := splitRecentTurns(messages, 1); i != 4 {
+		t.Errorf("expected the last turn to start at 4, got %d", i)
+	}
+	if i := splitRecentTurns(messages, 2); i != 0 {
+		t.Errorf("expected tool results not to count as turns, got %d", i)
+	}
+	if i := splitRecentTurns(messages, 5); i != 0 {
+		t.Errorf("expected everything to be recent, got %d", i)
+	}
+	if i := splitRecentTurns(messages, 0); i != len(messages) {
+		t.Errorf("expected nothing to be recent, got %d", i)
+	}
+}
+
+func TestShrinkMessages(t *testing.T) {
+	long := strings.Repeat("a", 300) + strings.Repeat("z", 300)
+	messages := []llms.Message{
+		text("user", long),
+		{Role: "assistant", Content: content.Content{&content.Thought{Text: "hmm"}, &content.Text{Text: "let me look"}}},
+		{Role: "user", ToolCallID: "1", Content: content.Content{&content.Text{Text: long}, &content.ImageURL{URL: "data:image/png;base64,AAAA"}}},
+	}
+	shrunk := shrinkMessages(messages, 50)
+
+	if contentText(shrunk[0].Content) != long {
+		t.Error("expected user messages to be kept")
+	}
+	if len(shrunk[1].Content) != 1 || contentText(shrunk[1].Content) != "let me look" {
+		t.Errorf("expected thoughts to be removed, got %+v", shrunk[1].Content)
+	}
+	result := contentText(shrunk[2].Content)
+	if len(result) >= len(long) || !strings.HasPrefix(result, "aaa") || !strings.HasSuffix(result, "zzz\n[An image was removed to save space.]") {
+		t.Errorf("expected the tool result to be truncated in the middle, got %q", result)
+	}
+	if _, ok := shrunk[2].Content[1].(*content.ImageURL); ok {
+		t.Error("expected the image to be removed")
+	}
+	if _, ok := messages[2].Content[1].(*content.ImageURL); !ok {
+		t.Error("expected the original messages to be left alone")
+	}
+	if EstimateTokens(shrunk) >= EstimateTokens(messages) {
+		t.Errorf("expected shrinking to reduce the estimate from %d, got %d", EstimateTokens(messages), EstimateTokens(shrunk))
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	if s := truncateMiddle("short", 10); s != "short" {
+		t.Errorf("expected short strings to be kept, got %q", s)
+	}
+	s := truncateMiddle(strings.Repeat("é", 100), 30)
+	if !strings.Contains(s, "characters removed") {
+		t.Errorf("expected a note about the removed text, got %q", s)
+	}
+	for _, r := range s {
+		if r == '�' {
+			t.Fatalf("expected valid UTF-8, got %q", s)
+		}
+	}
+}
+
+func TestCompactLongTurn(t *testing.T) {
+	huge := strings.Repeat("log line\n", 5_000)
+	a := New(nil)
+	a.SetMessages([]llms.Message{
+		text("user", "why is the disk full?"),
+		{Role: "assistant", ToolCalls: []llms.ToolCall{{ID: "1", Name: "run_shell_cmd", Arguments: []byte(`{"command":"cat /var/log/syslog"}`)}}},
+		{Role: "user", ToolCallID: "1", Content: content.FromText(huge)},
+		{Role: "assistant", ToolCalls: []llms.ToolCall{{ID: "2", Name: "run_shell_cmd", Arguments: []byte(`{"command":"du -sh /var/*"}`)}}},
+		{Role: "user", ToolCallID: "2", Content: content.FromText(huge)},
+		text("assistant", "The logs are huge."),
+	})
+	opts := DefaultCompactOptions
+	opts.MaxTokens = 5_000
+	before, after, err := a.compact(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if before <= opts.MaxTokens || after > opts.MaxTokens {
+		t.Errorf("expected the turn to be shrunk to fit in %d tokens, went from %d to %d", opts.MaxTokens, before, after)
+	}
+	messages := a.Messages()
+	if len(messages) != 6 || contentText(messages[0].Content) != "why is the disk full?" {
+		t.Errorf("expected the messages of the turn to be kept, got %d", len(messages))
+	}
+}
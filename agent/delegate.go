@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// DelegateToolName is the name of the tool returned by DelegateTool.
+const DelegateToolName = "delegate_task"
+
+const delegatePrompt = `You are a sub-agent of First Aid, a command line assistant that helps users with computer problems. You've been given one task by First Aid, not by the user, and the user can't see anything you write.
+
+Use your tools to complete the task as thoroughly as you can without asking questions, since no one will answer them. When you're done, reply with a concise summary of what you found and did, including the details (paths, values, errors) that First Aid will need. Your summary is the only thing First Aid gets to see.`
+
+type DelegateParams struct {
+	Task  string   `json:"task" description:"A complete description of the task, including all the context the sub-agent needs, since it can't see this conversation."`
+	Tools []string `json:"tools,omitempty" description:"The names of the tools the sub-agent may use. Defaults to all the tools that can be delegated."`
+}
+
+// DelegateTool returns a tool that hands a task to a sub-agent with its own
+// history, and returns the sub-agent's final summary. Sub-agents use the same
+// provider and tool middlewares (such as approval) as a, and may only use
+// a's tools that are named in allowed. Calls may run in parallel.
+func (a *Agent) DelegateTool(allowed []string) tools.Tool {
+	description := fmt.Sprintf("Hand a self-contained task to a sub-agent, which works on it with its own context and returns a summary of the results. Use this for big tasks that would otherwise fill up this conversation, such as going through many files, and for independent tasks that can run at the same time (call the tool several times at once). The sub-agent may use these tools: %s.", strings.Join(allowed, ", "))
+	return tools.Func("Delegate task", description, DelegateToolName, func(r tools.Runner, p DelegateParams) tools.Result {
+		label := fmt.Sprintf("Delegate: %s", summarizeTask(p.Task))
+		if strings.TrimSpace(p.Task) == "" {
+			return tools.ErrorWithLabel(label, fmt.Errorf("the task must not be empty"))
+		}
+		names := p.Tools
+		if len(names) == 0 {
+			names = allowed
+		}
+		var childTools []tools.Tool
+		for _, name := range names {
+			if !slices.Contains(allowed, name) || name == DelegateToolName {
+				return tools.ErrorWithLabel(label, fmt.Errorf("the tool %q can't be delegated (allowed tools: %s)", name, strings.Join(allowed, ", ")))
+			}
+			i := slices.IndexFunc(a.tools, func(t tools.Tool) bool { return t.FuncName() == name })
+			if i < 0 || a.disabled[name] {
+				return tools.ErrorWithLabel(label, fmt.Errorf("the tool %q is not available", name))
+			}
+			childTools = append(childTools, a.tools[i])
+		}
+
+		child := New(a.middlewareProvider(a.provider), childTools...)
+		child.middlewares = a.middlewares
+		child.debug = a.debug
+		child.SystemPrompt = func() content.Content {
+			return content.FromText(delegatePrompt)
+		}
+
+		r.Report(label)
+		var summary strings.Builder
+		for update := range child.Chat(r.Context(), p.Task) {
+			switch update := update.(type) {
+			case llms.ToolStartUpdate:
+				summary.Reset()
+				r.Report(fmt.Sprintf("%s › %s", label, update.Tool.Label()))
+			case llms.ToolStatusUpdate:
+				r.Report(fmt.Sprintf("%s › %s", label, update.Status))
+			case llms.TextUpdate:
+				summary.WriteString(update.Text)
+			}
+		}
+		a.addUsage(child.Usage())
+		if err := r.Context().Err(); err != nil {
+			return tools.ErrorWithLabel(label, err)
+		}
+		if err := child.Err(); err != nil {
+			return tools.ErrorWithLabel(label, fmt.Errorf("the sub-agent failed: %w", err))
+		}
+		text := strings.TrimSpace(summary.String())
+		if text == "" {
+			text = "The sub-agent finished without a summary."
+		}
+		return tools.SuccessWithContent(label, content.FromText(text))
+	})
+}
+
+// summarizeTask shortens a task description for labels.
+func summarizeTask(task string) string {
+	task = strings.Join(strings.Fields(task), " ")
+	if runes := []rune(task); len(runes) > 40 {
+		return string(runes[:39]) + "…"
+	}
+	return task
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/llmtest"
+)
+
+type testRunner struct{}
+
+func (testRunner) Context() context.Context { return context.Background() }
+func (testRunner) Report(string)            {}
+
+// recordingRunner records the statuses that a tool reports.
+type recordingRunner struct {
+	mu       sync.Mutex
+	statuses []string
+}
+
+func (r *recordingRunner) Context() context.Context { return context.Background() }
+
+func (r *recordingRunner) Report(status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, status)
+}
+
+// middlewareTool replaces the Run method of the tool it wraps.
+type middlewareTool struct {
+	tools.Tool
+	run func(r tools.Runner, params json.RawMessage) tools.Result
+}
+
+func (t middlewareTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	return t.run(r, params)
+}
+
+func TestSummarizeTask(t *testing.T) {
+	if got := summarizeTask("  find   the\nlogs "); got != "find the logs" {
+		t.Errorf("expected whitespace to be collapsed, got %q", got)
+	}
+	got := summarizeTask(strings.Repeat("å", 100))
+	if runes := []rune(got); len(runes) != 40 || runes[39] != '…' {
+		t.Errorf("expected the task to be cut to 40 runes, got %q", got)
+	}
+}
+
+func TestDelegateToolRejectsTools(t *testing.T) {
+	type params struct{}
+	a := New(nil,
+		tools.Func("List", "List files", "list_files", func(r tools.Runner, p params) tools.Result { return nil }),
+		tools.Func("Shell", "Run a command", "run_shell_cmd", func(r tools.Runner, p params) tools.Result { return nil }),
+	)
+	delegate := a.DelegateTool([]string{"list_files"})
+	for _, args := range []string{
+		`{"task": ""}`,
+		`{"task": "look around", "tools": ["run_shell_cmd"]}`,
+		`{"task": "look around", "tools": ["delegate_task"]}`,
+	} {
+		if err := delegate.Run(testRunner{}, []byte(args)).Error(); err == nil {
+			t.Errorf("expected an error for %s", args)
+		}
+	}
+}
+
+func TestDelegateTool(t *testing.T) {
+	provider := llmtest.NewProvider(t,
+		llmtest.Response{
+			llmtest.ToolCall("list_files", `{"path": "/root"}`),
+			llmtest.Usage(100, 10),
+		},
+		llmtest.Response{
+			llmtest.ExpectToolResult("list_files", "denied"),
+			llmtest.ToolCall("list_files", `{"path": "/var/log"}`),
+			llmtest.Usage(120, 10),
+		},
+		llmtest.Response{
+			llmtest.ExpectToolResult("list_files", "syslog"),
+			llmtest.Text("The logs are in /var/log/syslog."),
+			llmtest.Usage(150, 20),
+		},
+	)
+	type params struct {
+		Path string `json:"path"`
+	}
+	a := New(provider,
+		tools.Func("List files", "List files", "list_files", func(r tools.Runner, p params) tools.Result {
+			r.Report("Listing " + p.Path)
+			return tools.SuccessWithLabel("Listed "+p.Path, map[string]any{"files": []string{"syslog"}})
+		}),
+		tools.Func("Shell", "Run a command", "run_shell_cmd", func(r tools.Runner, p params) tools.Result { return nil }),
+	)
+	// Stand-ins for the approval gate and the audit log, which wraps it.
+	a.Use(func(t tools.Tool) tools.Tool {
+		return middlewareTool{t, func(r tools.Runner, params json.RawMessage) tools.Result {
+			if strings.Contains(string(params), "/root") {
+				return tools.ErrorWithLabel("Denied", errors.New("the user denied this"))
+			}
+			return t.Run(r, params)
+		}}
+	})
+	var audited []string
+	a.Use(func(t tools.Tool) tools.Tool {
+		return middlewareTool{t, func(r tools.Runner, params json.RawMessage) tools.Result {
+			audited = append(audited, t.FuncName()+" "+string(params))
+			return t.Run(r, params)
+		}}
+	})
+
+	r := &recordingRunner{}
+	result := a.DelegateTool([]string{"list_files"}).Run(r, json.RawMessage(`{"task": "Find the logs"}`))
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text := llmtest.ContentText(result.Content()); text != "The logs are in /var/log/syslog." {
+		t.Errorf("expected the sub-agent's summary, got %q", text)
+	}
+	if want := []string{`list_files {"path": "/root"}`, `list_files {"path": "/var/log"}`}; !slices.Equal(audited, want) {
+		t.Errorf("expected the sub-agent's calls to go through the middlewares, got %q", audited)
+	}
+	want := []string{
+		"Delegate: Find the logs",
+		"Delegate: Find the logs › List files",
+		"Delegate: Find the logs › List files",
+		"Delegate: Find the logs › Listing /var/log",
+	}
+	if !slices.Equal(r.statuses, want) {
+		t.Errorf("expected statuses %q, got %q", want, r.statuses)
+	}
+	if u := a.Usage(); u.InputTokens != 370 || u.OutputTokens != 40 {
+		t.Errorf("expected the sub-agent's usage to be added, got %+v", u)
+	}
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"iter"
+	"slices"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// historyProvider wraps a provider to record the message history it's called
+// with, plus the message it responds with. The LLM calls the provider with the
+// entire history for every request, so after each completed response the
+// agent has an up-to-date copy of the conversation. It also keeps count of the
+// tokens used.
+type historyProvider struct {
+	llms.Provider
+	agent *Agent
+}
+
+func (p *historyProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) llms.ProviderStream {
+	stream := p.Provider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+	return &historyStream{ProviderStream: stream, agent: p.agent, messages: messages}
+}
+
+type historyStream struct {
+	llms.ProviderStream
+	agent    *Agent
+	messages []llms.Message
+}
+
+func (s *historyStream) Iter() iter.Seq[llms.StreamStatus] {
+	return func(yield func(llms.StreamStatus) bool) {
+		for status := range s.ProviderStream.Iter() {
+			if !yield(status) {
+				return
+			}
+		}
+		s.agent.addUsage(s.Usage())
+		if s.Err() != nil {
+			return
+		}
+		s.agent.setHistory(append(slices.Clone(s.messages), s.Message()))
+	}
+}
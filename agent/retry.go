@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// RetryOptions configures how failed provider requests are retried.
+type RetryOptions struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles for every
+	// subsequent retry, up to MaxDelay, with random jitter added.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// OnRetry is called before waiting to retry after a retryable error.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+var DefaultRetryOptions = RetryOptions{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// Retry returns a provider middleware that retries requests that failed with
+// a retryable error (see IsRetryable). A request is only retried if the
+// provider hadn't streamed anything yet, since a partial response can't be
+// taken back.
+func Retry(opts RetryOptions) func(llms.Provider) llms.Provider {
+	return func(p llms.Provider) llms.Provider {
+		return &retryProvider{Provider: p, opts: opts}
+	}
+}
+
+type retryProvider struct {
+	llms.Provider
+	opts RetryOptions
+}
+
+func (p *retryProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) llms.ProviderStream {
+	generate := func() llms.ProviderStream {
+		return p.Provider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+	}
+	return &retryStream{ProviderStream: generate(), ctx: ctx, opts: p.opts, generate: generate}
+}
+
+type retryStream struct {
+	// ProviderStream is the stream of the current attempt.
+	llms.ProviderStream
+	ctx      context.Context
+	opts     RetryOptions
+	generate func() llms.ProviderStream
+}
+
+func (s *retryStream) Iter() iter.Seq[llms.StreamStatus] {
+	return func(yield func(llms.StreamStatus) bool) {
+		for attempt := 1; ; attempt++ {
+			streamed := false
+			for status := range s.ProviderStream.Iter() {
+				streamed = true
+				if !yield(status) {
+					return
+				}
+			}
+			err := s.ProviderStream.Err()
+			if err == nil || streamed || attempt >= s.opts.MaxAttempts || !IsRetryable(err) {
+				return
+			}
+			delay := backoff(s.opts, attempt)
+			if s.opts.OnRetry != nil {
+				s.opts.OnRetry(attempt, delay, err)
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			s.ProviderStream = s.generate()
+		}
+	}
+}
+
+// backoff returns the delay before the given retry attempt (starting at 1).
+// The delay grows exponentially, and a random half of it is jitter so that
+// many clients don't retry in lockstep.
+func backoff(opts RetryOptions, attempt int) time.Duration {
+	delay := opts.BaseDelay
+	for i := 1; i < attempt && delay < opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, opts.MaxDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+var (
+	// reRetryableStatus matches a retryable HTTP status code where providers
+	// put it: at the start of the error, maybe after the provider's name, or
+	// after "status" or "status code". Numbers elsewhere in the message, like
+	// "max_tokens: 500" in the body of a 400 error, don't count.
+	reRetryableStatus  = regexp.MustCompile(`(?:^(?:[\w-]+: )?|\bstatus(?:[ _]?code)?[:=]? ?)(408|425|429|500|502|503|504|529)\b`)
+	retryableFragments = []string{
+		"overloaded",
+		"rate limit",
+		"rate_limit",
+		"too many requests",
+		"temporarily unavailable",
+		"connection reset",
+		"connection refused",
+		"timeout",
+		"timed out",
+	}
+)
+
+// IsRetryable reports whether a provider error is likely to go away if the
+// request is made again, such as rate limits, overloaded servers and network
+// hiccups. Other errors, like invalid requests or bad API keys, are fatal.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	if reRetryableStatus.MatchString(msg) {
+		return true
+	}
+	for _, fragment := range retryableFragments {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("anthropic: 529 overloaded_error: Overloaded"), true},
+		{errors.New("429 Too Many Requests"), true},
+		{errors.New("rate limit exceeded"), true},
+		{fmt.Errorf("reading stream: %w", io.ErrUnexpectedEOF), true},
+		{errors.New("503 Service Unavailable"), true},
+		{errors.New("401 Unauthorized: invalid x-api-key"), false},
+		{errors.New("400 Bad Request: messages: roles must alternate"), false},
+		{errors.New("400 Bad Request: max_tokens: 500 is more than the model allows"), false},
+		{errors.New("anthropic: 401 Unauthorized: retry after 429ms won't help"), false},
+		{errors.New("error, status code: 502, message: bad gateway"), true},
+		{errors.New("unexpected status 504 from upstream"), true},
+		{fmt.Errorf("request failed: %w", context.Canceled), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	opts := RetryOptions{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for attempt, max := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		70: 10 * time.Second,
+	} {
+		for range 100 {
+			delay := backoff(opts, attempt)
+			if delay < max/2 || delay > max {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, delay, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/agent"
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/audit"
+	"github.com/blixt/first-aid/backup"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/recording"
+	"github.com/blixt/first-aid/redact"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/usage"
+)
+
+// app holds the state of a conversation with first-aid.
+type app struct {
+	cfg   *config.Config
+	ai    *agent.Agent
+	gate  *approval.Gate
+	store *session.Store
+	sess  *session.Session
+	usage *usage.Tracker
+
+	// backups keeps the versions of the files that tools change, and turn is
+	// the number of the current turn in the session that they're filed under.
+	backups *backup.Store
+	turn    int
+
+	// recorder records the session to a fixture file, if enabled.
+	recorder *recording.Recorder
+
+	// turnErr is an error that ended the last turn before the agent did, such
+	// as running out of budget.
+	turnErr error
+
+	// status shows a short-lived status message, such as a retry notice.
+	status func(status string)
+}
+
+// redactSecrets returns a tool middleware that hides secrets in tool results
+// from the model, unless redaction is disabled in the config.
+func redactSecrets(cfg *config.Config) func(tools.Tool) tools.Tool {
+	if !*cfg.RedactSecrets {
+		return func(t tools.Tool) tools.Tool { return t }
+	}
+	r, err := redact.New(cfg.RedactPatterns)
+	if err != nil {
+		// The patterns were checked when the config was loaded.
+		panic(err)
+	}
+	return r.Tool
+}
+
+// errBudgetExceeded ends a turn when the session costs more than the budget
+// and the budget action is to stop.
+var errBudgetExceeded = errors.New("the session is over its budget")
+
+// newApp creates the app for a session, restoring its history and usage
+// totals, and sets up the agent to back up edited files, check tool calls
+// with the gate, retry failed requests and compact the history as
+// configured.
+func newApp(cfg *config.Config, ai *agent.Agent, gate *approval.Gate, store *session.Store, sess *session.Session) *app {
+	a := &app{cfg: cfg, ai: ai, gate: gate, store: store, sess: sess, status: func(string) {}}
+	a.usage = usage.NewTracker(sess.Usage, sess.Cost)
+	a.usage.Budget = cfg.Budget
+	a.usage.SetPrice(cfg.Price())
+
+	a.backups = backupStore(cfg)
+	// Numbering continues after the turns of the session that changed files
+	// before it was resumed.
+	a.turn, _ = a.backups.LastTurn(sess.ID)
+	// Added before the gate, so that only approved calls are backed up.
+	ai.Use(a.backups.Track(func() (string, int) { return a.sess.ID, a.turn }))
+	ai.Use(gate.Wrap)
+	ai.Use(redactSecrets(cfg))
+	// Added after the gate, so that denied calls are logged too.
+	ai.Use(audit.NewLog(cfg.AuditLog).Tool(func() string { return a.sess.ID }))
+	ai.SetMessages(sess.Messages)
+
+	retry := agent.DefaultRetryOptions
+	retry.MaxAttempts = *cfg.MaxRetries + 1
+	retry.OnRetry = func(attempt int, delay time.Duration, err error) {
+		a.status(fmt.Sprintf("%s (retrying in %.0f seconds, attempt %d of %d)", retryReason(err), delay.Seconds(), attempt+1, retry.MaxAttempts))
+	}
+	ai.UseProvider(agent.Retry(retry))
+
+	if *cfg.CompactAfterTokens > 0 {
+		compaction := agent.DefaultCompactOptions
+		compaction.MaxTokens = *cfg.CompactAfterTokens
+		compaction.OnCompact = func(tokens int) {
+			a.status(fmt.Sprintf("Summarizing older parts of the conversation (about %d tokens)", tokens))
+		}
+		ai.SetCompaction(&compaction)
+	}
+	return a
+}
+
+// chat runs one turn of the conversation. The session is saved once the turn
+// is over, even if it failed or was interrupted.
+func (a *app) chat(ctx context.Context, input string) <-chan llms.Update {
+	a.sess.SetTitle(input)
+	if a.recorder != nil {
+		a.recorder.Turn(input)
+	}
+	a.turnErr = nil
+	a.turn++
+	a.usage.StartTurn()
+	updates := make(chan llms.Update)
+	if a.usage.ShouldStop() {
+		a.turnErr = errBudgetExceeded
+		close(updates)
+		return updates
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(updates)
+		defer a.save()
+		defer cancel()
+		seen := a.ai.Usage()
+		for update := range a.ai.Chat(ctx, input) {
+			if thinking, ok := update.(llms.ThinkingUpdate); ok {
+				a.usage.Add(usage.Tokens{Thinking: usage.EstimateTokens(thinking.Text)})
+			}
+			seen = a.recordUsage(seen)
+			if a.turnErr == nil && a.usage.ShouldStop() {
+				a.turnErr = errBudgetExceeded
+				cancel()
+			}
+			updates <- update
+		}
+		a.recordUsage(seen)
+	}()
+	return updates
+}
+
+// recordUsage adds the tokens the agent used since it last reported seen.
+func (a *app) recordUsage(seen llms.Usage) llms.Usage {
+	current := a.ai.Usage()
+	a.usage.Add(usage.Tokens{
+		Input:       current.InputTokens - seen.InputTokens,
+		CachedInput: current.CachedInputTokens - seen.CachedInputTokens,
+		Output:      current.OutputTokens - seen.OutputTokens,
+	})
+	return current
+}
+
+// err returns the error that ended the last turn, if any.
+func (a *app) err() error {
+	if a.turnErr != nil {
+		return a.turnErr
+	}
+	return a.ai.Err()
+}
+
+// budgetMessage describes the budget of the session.
+func (a *app) budgetMessage() string {
+	s := a.usage.Summary()
+	return fmt.Sprintf("This session has cost about $%.2f, which is over the budget of $%.2f.", s.SessionCost, a.usage.Budget.MaxUSD)
+}
+
+// retryReason describes a retryable provider error in a few words.
+func retryReason(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "overloaded") || strings.Contains(msg, "529"):
+		return "Provider is overloaded"
+	case strings.Contains(msg, "rate limit") || strings.Contains(msg, "rate_limit") || strings.Contains(msg, "429"):
+		return "Rate limited"
+	default:
+		return "Provider request failed"
+	}
+}
+
+// providerErrorMessage describes an error that ended a turn.
+func providerErrorMessage(err error) string {
+	if errors.Is(err, errBudgetExceeded) {
+		return "I stopped because this session is over its budget. Raise the budget to continue."
+	}
+	msg, _, _ := strings.Cut(strings.TrimSpace(err.Error()), "\n")
+	if agent.IsRetryable(err) {
+		return fmt.Sprintf("The provider kept failing, so I gave up: %s", msg)
+	}
+	return fmt.Sprintf("The provider refused to cooperate: %s", msg)
+}
+
+func (a *app) save() {
+	a.sess.Messages = a.ai.Messages()
+	summary := a.usage.Summary()
+	a.sess.Usage = summary.Session
+	a.sess.Cost = summary.SessionCost
+	if err := a.store.Save(a.sess); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save session: %v\n", err)
+	}
+}
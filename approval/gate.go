@@ -0,0 +1,94 @@
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+type Answer int
+
+const (
+	Denied Answer = iota
+	Approved
+	AlwaysApproved
+)
+
+// Request describes a tool call that needs the user's approval.
+type Request struct {
+	Tool    tools.Tool
+	Args    json.RawMessage
+	Subject string
+}
+
+// Gate decides whether tool calls may run, asking the user through Prompt
+// when the policy says so.
+type Gate struct {
+	Policy *Policy
+	// Prompt asks the user to approve a tool call. If nil, calls that need
+	// approval are denied (or approved, if ApproveAll is set).
+	Prompt func(req Request) Answer
+	// ApproveAll approves every call that the policy doesn't deny.
+	ApproveAll bool
+
+	mu          sync.Mutex
+	alwaysAllow map[string]bool
+}
+
+func NewGate(policy *Policy) *Gate {
+	return &Gate{Policy: policy, alwaysAllow: make(map[string]bool)}
+}
+
+// Check returns nil if the tool call may run, or an error explaining why not.
+func (g *Gate) Check(t tools.Tool, args json.RawMessage) error {
+	name := t.FuncName()
+	switch g.Policy.Decide(name, args) {
+	case Allow:
+		return nil
+	case Deny:
+		return fmt.Errorf("running %s was denied by the approval policy", name)
+	}
+
+	// Only ask one question at a time.
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.alwaysAllow[name] || g.ApproveAll {
+		return nil
+	}
+	if g.Prompt == nil {
+		return fmt.Errorf("running %s requires approval, but there is no one to ask (add an allow rule to the approval policy)", name)
+	}
+	switch g.Prompt(Request{Tool: t, Args: args, Subject: Subject(args)}) {
+	case AlwaysApproved:
+		g.alwaysAllow[name] = true
+		return nil
+	case Approved:
+		return nil
+	default:
+		return fmt.Errorf("the user denied running %s", name)
+	}
+}
+
+// Wrap returns a tool that checks with the gate before running t. Denied
+// calls are returned to the LLM as tool errors.
+func (g *Gate) Wrap(t tools.Tool) tools.Tool {
+	return &gatedTool{Tool: t, gate: g}
+}
+
+type gatedTool struct {
+	tools.Tool
+	gate *Gate
+}
+
+func (t *gatedTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	// Don't bother the user about a turn that was already canceled.
+	if err := r.Context().Err(); err != nil {
+		return tools.ErrorWithLabel(t.Label(), err)
+	}
+	if err := t.gate.Check(t.Tool, params); err != nil {
+		return tools.ErrorWithLabel(fmt.Sprintf("%s (denied)", t.Label()), err)
+	}
+	return t.Tool.Run(r, params)
+}
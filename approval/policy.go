@@ -0,0 +1,175 @@
+// Package approval asks for permission before tools that can change the
+// user's machine are run. Decisions come from a policy file of allow and deny
+// rules, falling back to asking the user.
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type Action string
+
+const (
+	Allow Action = "allow"
+	Deny  Action = "deny"
+	Ask   Action = "ask"
+)
+
+// Mutating lists the tools that require approval unless a rule says
+// otherwise. All other tools are allowed by default, unless the policy was
+// told otherwise with RequireApproval.
+var Mutating = map[string]bool{
+	"run_shell_cmd":        true,
+	"run_python":           true,
+	"splice_file":          true,
+	"restore_file_version": true,
+	"run_apple_script":     true,
+	"run_powershell_cmd":   true,
+	"schedule_task":        true,
+}
+
+// shellTools are the tools whose subject is a shell command. Allow rules for
+// them must match the whole command, and never allow commands with shell
+// metacharacters, so that e.g. "git status; rm -rf ~" isn't allowed by a rule
+// for "git status".
+var shellTools = map[string]bool{
+	"run_shell_cmd":      true,
+	"run_powershell_cmd": true,
+}
+
+// reShellMeta matches the characters that chain, substitute or redirect
+// shell commands.
+var reShellMeta = regexp.MustCompile("[;&|`<>\\n]|\\$\\(")
+
+// Rule matches tool calls by tool name and, optionally, a regular expression
+// that is matched against the call's subject (see Subject).
+type Rule struct {
+	// Tool is the function name of the tool, or "*" for all tools.
+	Tool    string `json:"tool"`
+	Pattern string `json:"pattern,omitempty"`
+	Action  Action `json:"action"`
+
+	re *regexp.Regexp
+	// full matches only the whole subject, for allow rules on shell tools.
+	full *regexp.Regexp
+}
+
+// Policy is an ordered list of rules. The first matching rule decides.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+
+	// mutating lists more tools that require approval, like Mutating.
+	mutating map[string]bool
+}
+
+// RequireApproval makes the named tool require approval unless a rule says
+// otherwise, as if it were in Mutating. It must not be called while the
+// policy is in use.
+func (p *Policy) RequireApproval(name string) {
+	if p.mutating == nil {
+		p.mutating = make(map[string]bool)
+	}
+	p.mutating[name] = true
+}
+
+// LoadPolicy reads a policy file. A missing file results in an empty policy.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Policy{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p *Policy) compile() error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		switch r.Action {
+		case Allow, Deny, Ask:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i+1, r.Action)
+		}
+		if r.Tool == "" {
+			return fmt.Errorf("rule %d: missing tool", i+1)
+		}
+		if r.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		r.re = re
+		r.full = regexp.MustCompile(`^(?:` + r.Pattern + `)$`)
+	}
+	return nil
+}
+
+// Decide returns the action for a call to the named tool with the given JSON
+// arguments. Rules match anywhere in the subject, except allow rules for
+// shell tools (see shellTools).
+func (p *Policy) Decide(tool string, args json.RawMessage) Action {
+	var rules []Rule
+	var mutating map[string]bool
+	if p != nil {
+		rules, mutating = p.Rules, p.mutating
+	}
+	subject := Subject(args)
+	for _, r := range rules {
+		if r.Tool != "*" && r.Tool != tool {
+			continue
+		}
+		if r.Action == Allow && shellTools[tool] {
+			if reShellMeta.MatchString(subject) || (r.full != nil && !r.full.MatchString(subject)) {
+				continue
+			}
+		} else if r.re != nil && !r.re.MatchString(subject) {
+			continue
+		}
+		return r.Action
+	}
+	if Mutating[tool] || mutating[tool] {
+		return Ask
+	}
+	return Allow
+}
+
+// subjectKeys are the argument names that best describe what a tool call will
+// do, in order of preference.
+var subjectKeys = []string{"command", "path", "statements", "script_lines"}
+
+// Subject returns the part of the arguments that rules match against: the
+// command for shell tools, the path for file tools, the code for script tools,
+// and the raw JSON arguments for anything else.
+func Subject(args json.RawMessage) string {
+	var fields map[string]any
+	if err := json.Unmarshal(args, &fields); err == nil {
+		for _, key := range subjectKeys {
+			switch v := fields[key].(type) {
+			case string:
+				return v
+			case []any:
+				lines := make([]string, 0, len(v))
+				for _, item := range v {
+					lines = append(lines, fmt.Sprint(item))
+				}
+				return strings.Join(lines, "\n")
+			}
+		}
+	}
+	return string(args)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/peterh/liner"
+
+	"github.com/blixt/first-aid/approval"
+)
+
+// maxApprovalLines is how much of a tool call's subject is shown when asking
+// for approval.
+const maxApprovalLines = 10
+
+// askApproval shows the tool call and asks the user whether it may run.
+func askApproval(line *liner.State, req approval.Request) approval.Answer {
+	fmt.Printf("\r\033[K⚠️  %s (%s) wants to run:\n", req.Tool.Label(), req.Tool.FuncName())
+	lines := strings.Split(strings.TrimSpace(req.Subject), "\n")
+	for i, l := range lines {
+		if i == maxApprovalLines {
+			fmt.Printf("    … (+%d more lines)\n", len(lines)-i)
+			break
+		}
+		fmt.Printf("    %s\n", l)
+	}
+	for {
+		answer, err := line.Prompt("Allow? [y]es, [n]o, [a]lways for this tool: ")
+		if err != nil {
+			// Treat Ctrl-C and Ctrl-D as a no.
+			fmt.Println()
+			return approval.Denied
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return approval.Approved
+		case "n", "no":
+			return approval.Denied
+		case "a", "always":
+			return approval.AlwaysApproved
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blixt/first-aid/audit"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/schedule"
+)
+
+// runAudit prints the tool calls in the audit log that match the flags in
+// args, and returns the exit code.
+func runAudit(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	toolNames := fs.String("tool", "", "Only show calls to these tools (comma separated)")
+	session := fs.String("session", "", "Only show calls made in this session")
+	since := fs.String("since", "", `Only show calls since this time ("24h", "2025-07-09" or "2025-07-09 14:00")`)
+	until := fs.String("until", "", "Only show calls before this time")
+	failed := fs.Bool("failed", false, "Only show calls that failed")
+	grep := fs.String("grep", "", "Only show calls with this text in their parameters, label or error")
+	limit := fs.Int("limit", 50, "Show at most this many of the most recent calls (0 means all)")
+	jsonOutput := fs.Bool("json", false, "Print the entries as JSON lines, with their full parameters")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: first-aid audit [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	filter := audit.Filter{Session: *session, Failed: *failed, Text: *grep}
+	if *toolNames != "" {
+		filter.Tools = strings.Split(*toolNames, ",")
+	}
+	var err error
+	if filter.Since, err = parseAuditTime(*since, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if filter.Until, err = parseAuditTime(*until, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	log := audit.NewLog(cfg.AuditLog)
+	entries, err := log.Query(filter, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			enc.Encode(e)
+		}
+		return 0
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No tool calls found in %s.\n", log.Path())
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSESSION\tTOOL\tRESULT\tDURATION\tBYTES IN/OUT\tLABEL")
+	for _, e := range entries {
+		result := "ok"
+		if e.Error != "" {
+			result = "error"
+		}
+		label := truncate(strings.ReplaceAll(e.Label, "\n", " "), 80)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d/%d\t%s\n", e.Time.Local().Format(time.DateTime), e.Session, e.Tool, result, e.Duration(), e.ParamsBytes, e.ResultBytes, label)
+	}
+	tw.Flush()
+	return 0
+}
+
+// parseAuditTime parses a time for the audit flags: a duration before now,
+// a date, or a time accepted by schedule.ParseTime.
+func parseAuditTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := schedule.ParseTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use a duration like 24h, a date like 2025-07-09 or a time like \"2025-07-09 14:00\"", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,197 @@
+// Package audit keeps an append-only log of every tool call, as JSON lines,
+// so that what first-aid did on the machine can be looked into afterwards.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/jsonl"
+)
+
+// Entry is a tool call.
+type Entry struct {
+	// Time is when the call started.
+	Time    time.Time       `json:"time"`
+	Session string          `json:"session,omitempty"`
+	Cwd     string          `json:"cwd,omitempty"`
+	Tool    string          `json:"tool"`
+	Params  json.RawMessage `json:"params"`
+	Label   string          `json:"label"`
+	Error   string          `json:"error,omitempty"`
+	// DurationMS is how long the call took, in milliseconds.
+	DurationMS int64 `json:"durationMs"`
+	// ParamsBytes and ResultBytes are the sizes of the parameters and the
+	// content of the result.
+	ParamsBytes int `json:"paramsBytes"`
+	ResultBytes int `json:"resultBytes"`
+}
+
+// Duration returns how long the call took.
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMS) * time.Millisecond
+}
+
+// Log is an append-only log of tool calls.
+type Log struct {
+	path string
+	// OnError is called when an entry can't be written. It defaults to
+	// printing the error to stderr.
+	OnError func(err error)
+}
+
+// NewLog returns the log stored at path. The file is created when the first
+// call is added.
+func NewLog(path string) *Log {
+	return &Log{
+		path: path,
+		OnError: func(err error) {
+			fmt.Fprintf(os.Stderr, "Failed to write to the audit log: %v\n", err)
+		},
+	}
+}
+
+// Path returns the path of the log file.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds an entry to the log.
+func (l *Log) Append(e Entry) error {
+	return jsonl.Append(l.path, e)
+}
+
+// Tool returns a middleware that logs every call to the tool it wraps, with
+// the ID of the session it's made in.
+func (l *Log) Tool(session func() string) func(tools.Tool) tools.Tool {
+	return func(t tools.Tool) tools.Tool {
+		return &auditedTool{Tool: t, log: l, session: session}
+	}
+}
+
+type auditedTool struct {
+	tools.Tool
+	log     *Log
+	session func() string
+}
+
+func (t *auditedTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	started := time.Now()
+	result := t.Tool.Run(r, params)
+	cwd, _ := os.Getwd()
+	e := Entry{
+		Time:        started,
+		Session:     t.session(),
+		Cwd:         cwd,
+		Tool:        t.FuncName(),
+		Params:      params,
+		Label:       result.Label(),
+		DurationMS:  time.Since(started).Milliseconds(),
+		ParamsBytes: len(params),
+		ResultBytes: contentSize(result.Content()),
+	}
+	if len(e.Params) == 0 || !json.Valid(e.Params) {
+		// Keep the entry valid JSON, whatever the model sent.
+		e.Params, _ = json.Marshal(string(params))
+	}
+	if err := result.Error(); err != nil {
+		e.Error = err.Error()
+	}
+	if err := t.log.Append(e); err != nil {
+		t.log.OnError(err)
+	}
+	return result
+}
+
+// contentSize returns the number of bytes of text, JSON and image URLs in c.
+func contentSize(c content.Content) int {
+	n := 0
+	for _, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			n += len(item.Text)
+		case *content.JSON:
+			n += len(item.Data)
+		case *content.ImageURL:
+			n += len(item.URL)
+		}
+	}
+	return n
+}
+
+// Filter selects entries of the log. The zero value selects all of them.
+type Filter struct {
+	// Tools are the names of the tools to include.
+	Tools   []string
+	Session string
+	// Since and Until limit the time of the calls.
+	Since, Until time.Time
+	// Failed only includes calls that failed.
+	Failed bool
+	// Text only includes calls with the text (ignoring case) in their
+	// parameters, label or error.
+	Text string
+}
+
+// Match reports whether the entry is selected by the filter.
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case len(f.Tools) > 0 && !slices.Contains(f.Tools, e.Tool):
+		return false
+	case f.Session != "" && e.Session != f.Session:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Failed && e.Error == "":
+		return false
+	}
+	if f.Text != "" {
+		text := strings.ToLower(f.Text)
+		return strings.Contains(strings.ToLower(string(e.Params)), text) ||
+			strings.Contains(strings.ToLower(e.Label), text) ||
+			strings.Contains(strings.ToLower(e.Error), text)
+	}
+	return true
+}
+
+// Query returns the entries selected by the filter, oldest first. If limit
+// is more than 0, only the last limit entries are returned. Broken lines are
+// skipped with a warning on stderr.
+func (l *Log) Query(f Filter, limit int) ([]Entry, error) {
+	var entries []Entry
+	skipped, err := jsonl.Read(l.path, func(e Entry) {
+		if !f.Match(e) {
+			return
+		}
+		entries = append(entries, e)
+		if limit > 0 && len(entries) > 2*limit {
+			entries = slices.Delete(entries, 0, len(entries)-limit)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d broken %s in %s.\n", skipped, plural(skipped, "line"), l.path)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
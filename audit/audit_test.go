@@ -0,0 +1,128 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/audit"
+)
+
+type echoParams struct {
+	Text string `json:"text"`
+}
+
+type testRunner struct{}
+
+func (testRunner) Context() context.Context { return context.Background() }
+func (testRunner) Report(string)            {}
+
+var echo = tools.Func("Echo", "Echo the text", "echo", func(r tools.Runner, p echoParams) tools.Result {
+	if p.Text == "" {
+		return tools.ErrorWithLabel("Echo", errors.New("nothing to echo"))
+	}
+	return tools.SuccessWithLabel("Echo "+p.Text, map[string]string{"text": p.Text})
+})
+
+func TestLog(t *testing.T) {
+	log := audit.NewLog(filepath.Join(t.TempDir(), "audit", "audit.jsonl"))
+	session := "first"
+	tool := log.Tool(func() string { return session })(echo)
+
+	before := time.Now()
+	tool.Run(testRunner{}, json.RawMessage(`{"text": "hello"}`))
+	tool.Run(testRunner{}, json.RawMessage(`{}`))
+	session = "second"
+	tool.Run(testRunner{}, json.RawMessage(`{"text": "rm -rf /tmp/x"}`))
+
+	entries, err := log.Query(audit.Filter{}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Tool != "echo" || e.Session != "first" || e.Label != "Echo hello" || e.Error != "" || e.Time.Before(before) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if string(e.Params) != `{"text":"hello"}` || e.ParamsBytes != 17 || e.ResultBytes == 0 {
+		t.Errorf("expected the parameters and sizes to be logged, got %+v", e)
+	}
+	if entries[1].Error != "nothing to echo" {
+		t.Errorf("expected the error to be logged, got %q", entries[1].Error)
+	}
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		limit  int
+		want   []string
+	}{
+		{"all", audit.Filter{}, 0, []string{"Echo hello", "Echo", "Echo rm -rf /tmp/x"}},
+		{"limit", audit.Filter{}, 2, []string{"Echo", "Echo rm -rf /tmp/x"}},
+		{"session", audit.Filter{Session: "first"}, 0, []string{"Echo hello", "Echo"}},
+		{"failed", audit.Filter{Failed: true}, 0, []string{"Echo"}},
+		{"text", audit.Filter{Text: "RM -RF"}, 0, []string{"Echo rm -rf /tmp/x"}},
+		{"tool", audit.Filter{Tools: []string{"run_shell_cmd"}}, 0, nil},
+		{"since", audit.Filter{Since: time.Now().Add(time.Hour)}, 0, nil},
+		{"until", audit.Filter{Until: before}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(tt.filter, tt.limit)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var labels []string
+			for _, e := range entries {
+				labels = append(labels, e.Label)
+			}
+			if !slices.Equal(labels, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, labels)
+			}
+		})
+	}
+}
+
+func TestLogInvalidParams(t *testing.T) {
+	log := audit.NewLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	log.Tool(func() string { return "" })(echo).Run(testRunner{}, json.RawMessage(`{"text": `))
+	entries, err := log.Query(audit.Filter{}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var params string
+	if len(entries) != 1 || json.Unmarshal(entries[0].Params, &params) != nil || params != `{"text": ` {
+		t.Errorf("expected the invalid parameters to be logged as a string, got %+v", entries)
+	}
+}
+
+func TestLogBrokenLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := audit.NewLog(path)
+	tool := log.Tool(func() string { return "" })(echo)
+	tool.Run(testRunner{}, json.RawMessage(`{"text": "before"}`))
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time": "2026-` + "\n")
+	file.Close()
+	tool.Run(testRunner{}, json.RawMessage(`{"text": "after"}`))
+
+	entries, err := log.Query(audit.Filter{}, 0)
+	if err != nil {
+		t.Fatalf("expected the broken line to be skipped, got %v", err)
+	}
+	if len(entries) != 2 || entries[0].Label != "Echo before" || entries[1].Label != "Echo after" {
+		t.Errorf("expected the entries around the broken line, got %+v", entries)
+	}
+}
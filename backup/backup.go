@@ -0,0 +1,436 @@
+// Package backup keeps the earlier versions of files that first-aid edits in
+// a content-addressed store, indexed by session, turn and path, so that edits
+// can be undone without leaving backup files next to the originals.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blixt/first-aid/jsonl"
+)
+
+// Entry records the version of a file before it was changed.
+type Entry struct {
+	// Time is when the file was changed.
+	Time    time.Time `json:"time"`
+	Session string    `json:"session,omitempty"`
+	Turn    int       `json:"turn,omitempty"`
+	// Tool is what changed the file: the name of a tool, ToolUndo or
+	// ToolRestore.
+	Tool string `json:"tool"`
+	// Path is the absolute path of the file.
+	Path string `json:"path"`
+	// Hash is the SHA-256 of the content before the change, or empty if the
+	// file didn't exist.
+	Hash string      `json:"hash,omitempty"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode,omitempty"`
+}
+
+const (
+	// ToolUndo marks the changes made when undoing a turn.
+	ToolUndo = "undo"
+	// ToolRestore marks the changes made when restoring a version outside of
+	// a session.
+	ToolRestore = "restore"
+)
+
+// Version returns the short id of the version of the file in the entry, or
+// an empty string if the file didn't exist.
+func (e Entry) Version() string {
+	if len(e.Hash) < 12 {
+		return e.Hash
+	}
+	return e.Hash[:12]
+}
+
+// Retention limits how long backups are kept.
+type Retention struct {
+	// MaxAgeDays is the number of days to keep backups for. Defaults to 30.
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// MaxSizeMB is the most disk space, in megabytes, that backups may use.
+	// The oldest backups are removed first. Defaults to 500.
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+}
+
+var ErrNotFound = errors.New("backup not found")
+
+// Store keeps backups in a directory: the content in objects, named by its
+// hash, and the entries in index.jsonl.
+type Store struct {
+	dir       string
+	retention Retention
+
+	mu     sync.Mutex
+	pruned bool
+}
+
+// NewStore returns the store in dir. Old backups are pruned according to the
+// retention the first time a backup is saved.
+func NewStore(dir string, retention Retention) *Store {
+	return &Store{dir: dir, retention: retention}
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, "index.jsonl")
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash[2:])
+}
+
+// snapshot is the state of a file at one point in time.
+type snapshot struct {
+	exists bool
+	hash   string
+	data   []byte
+	mode   fs.FileMode
+}
+
+func (a snapshot) equal(b snapshot) bool {
+	return a.exists == b.exists && a.hash == b.hash
+}
+
+// read returns the current state of the file at path.
+func read(path string) (snapshot, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot{}, nil
+	} else if err != nil {
+		return snapshot{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return snapshot{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}, err
+	}
+	sum := sha256.Sum256(data)
+	return snapshot{exists: true, hash: hex.EncodeToString(sum[:]), data: data, mode: info.Mode().Perm()}, nil
+}
+
+// store writes the content of the snapshot to the objects directory, unless
+// it's already there.
+func (s *Store) store(snap snapshot) error {
+	if !snap.exists {
+		return nil
+	}
+	path := s.objectPath(snap.hash)
+	if _, err := os.Stat(path); err == nil {
+		// Mark it as in use so that it isn't pruned before it's indexed.
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeAtomically(path, snap.data, 0600)
+}
+
+// record adds an entry for the change of the file at path from the state in
+// before, which must already be stored.
+func (s *Store) record(path string, before snapshot, session string, turn int, tool string) error {
+	e := Entry{
+		Time:    time.Now(),
+		Session: session,
+		Turn:    turn,
+		Tool:    tool,
+		Path:    path,
+		Hash:    before.hash,
+		Size:    int64(len(before.data)),
+		Mode:    before.mode,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := jsonl.Append(s.indexPath(), e); err != nil {
+		return err
+	}
+	if !s.pruned {
+		s.pruned = true
+		return s.prune(time.Now())
+	}
+	return nil
+}
+
+// Entries returns all the entries, oldest first. Broken lines are skipped.
+func (s *Store) Entries() ([]Entry, error) {
+	return jsonl.ReadAll[Entry](s.indexPath())
+}
+
+// Versions returns the entries for the file at path, newest first.
+func (s *Store) Versions(path string) ([]Entry, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var versions []Entry
+	for _, e := range slices.Backward(entries) {
+		if e.Path == path {
+			versions = append(versions, e)
+		}
+	}
+	return versions, nil
+}
+
+// Find returns the newest entry with a version starting with version, or
+// ErrNotFound. If path isn't empty, only entries for that file are
+// considered.
+func (s *Store) Find(version, path string) (Entry, error) {
+	if version == "" {
+		return Entry{}, ErrNotFound
+	}
+	entries, err := s.Entries()
+	if err != nil {
+		return Entry{}, err
+	}
+	var found *Entry
+	for _, e := range slices.Backward(entries) {
+		if !strings.HasPrefix(e.Hash, version) || (path != "" && e.Path != path) {
+			continue
+		}
+		if found == nil {
+			found = &e
+		} else if found.Hash != e.Hash {
+			return Entry{}, fmt.Errorf("version %q is ambiguous, use more of it", version)
+		}
+	}
+	if found == nil {
+		return Entry{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+// Read returns the content of the version in the entry.
+func (s *Store) Read(e Entry) ([]byte, error) {
+	if e.Hash == "" {
+		return nil, fmt.Errorf("%s didn't exist at that point", e.Path)
+	}
+	data, err := os.ReadFile(s.objectPath(e.Hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// LastTurn returns the number of the last turn of the session that changed
+// any files, or 0 if there wasn't one.
+func (s *Store) LastTurn(session string) (int, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return 0, err
+	}
+	turn := 0
+	for _, e := range entries {
+		if e.Session == session {
+			turn = max(turn, e.Turn)
+		}
+	}
+	return turn, nil
+}
+
+// Restore changes the file at path back to the version in the entry (or
+// removes it, if it didn't exist then), after backing up its current
+// content as a change made by tool in the session's turn. It reports whether
+// the file changed.
+func (s *Store) Restore(path string, e Entry, session string, turn int, tool string) (bool, error) {
+	before, err := read(path)
+	if err != nil {
+		return false, err
+	}
+	if before.exists && before.hash == e.Hash {
+		return false, nil
+	}
+	if !before.exists && e.Hash == "" {
+		return false, nil
+	}
+	if err := s.store(before); err != nil {
+		return false, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if e.Hash == "" {
+		if err := os.Remove(path); err != nil {
+			return false, err
+		}
+	} else {
+		data, err := s.Read(e)
+		if err != nil {
+			return false, err
+		}
+		mode := e.Mode
+		if before.exists {
+			mode = before.mode
+		} else if mode == 0 {
+			mode = 0644
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return false, err
+		}
+		if err := writeAtomically(path, data, mode); err != nil {
+			return false, err
+		}
+	}
+	return true, s.record(path, before, session, turn, tool)
+}
+
+// Undo reverts the changes to files made in the last turn of the session
+// that hasn't been undone yet. It returns the turn and the paths of the files
+// that were reverted, or ErrNotFound if there was nothing to undo.
+func (s *Store) Undo(session string) (int, []string, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return 0, nil, err
+	}
+	// Most turns don't change any files, so the turn to undo is the last one
+	// with changes that haven't been undone, not just the one before.
+	undone := map[int]bool{}
+	var edited []int
+	for _, e := range entries {
+		if e.Session != session || e.Turn == 0 {
+			continue
+		}
+		if e.Tool == ToolUndo {
+			undone[e.Turn] = true
+		} else {
+			edited = append(edited, e.Turn)
+		}
+	}
+	turn := 0
+	for _, t := range edited {
+		if !undone[t] {
+			turn = max(turn, t)
+		}
+	}
+	// The first entry for each file has the version from before the turn.
+	var paths []string
+	first := map[string]Entry{}
+	for _, e := range entries {
+		if e.Session != session || e.Turn != turn || e.Tool == ToolUndo {
+			continue
+		}
+		if _, ok := first[e.Path]; !ok {
+			first[e.Path] = e
+			paths = append(paths, e.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return 0, nil, ErrNotFound
+	}
+	var reverted []string
+	for _, path := range paths {
+		changed, err := s.Restore(path, first[path], session, turn, ToolUndo)
+		if err != nil {
+			return turn, reverted, fmt.Errorf("failed to revert %s: %w", path, err)
+		}
+		if changed {
+			reverted = append(reverted, path)
+		}
+	}
+	if len(reverted) == 0 {
+		// The files were already back to how they were. Record the undo
+		// anyway, so that the next one moves on to the turn before.
+		current, err := read(paths[0])
+		if err == nil {
+			err = s.store(current)
+		}
+		if err == nil {
+			err = s.record(paths[0], current, session, turn, ToolUndo)
+		}
+		if err != nil {
+			return turn, nil, err
+		}
+	}
+	return turn, reverted, nil
+}
+
+// prune removes the entries that are older than the retention allows or
+// that don't fit in its size, newest entries first, then any content that's
+// no longer needed. It must be called with s.mu held. Other first-aid
+// processes don't hold it, so an entry that one of them records while the
+// index is being rewritten may be lost. That's rare, as each process prunes
+// once, and only costs the undo of that change.
+func (s *Store) prune(now time.Time) error {
+	entries, err := s.Entries()
+	if err != nil {
+		return err
+	}
+	cutoff := now.AddDate(0, 0, -s.retention.MaxAgeDays)
+	maxBytes := int64(s.retention.MaxSizeMB) << 20
+	var kept []Entry
+	var size int64
+	sized := map[string]bool{}
+	for _, e := range slices.Backward(entries) {
+		if s.retention.MaxAgeDays > 0 && e.Time.Before(cutoff) {
+			continue
+		}
+		if e.Hash != "" && !sized[e.Hash] {
+			sized[e.Hash] = true
+			size += e.Size
+		}
+		if s.retention.MaxSizeMB > 0 && size > maxBytes {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	slices.Reverse(kept)
+	if len(kept) < len(entries) {
+		if err := jsonl.Write(s.indexPath(), kept); err != nil {
+			return err
+		}
+	}
+
+	needed := map[string]bool{}
+	for _, e := range kept {
+		needed[e.Hash] = true
+	}
+	objects := filepath.Join(s.dir, "objects")
+	return filepath.WalkDir(objects, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(objects, path)
+		if err != nil || needed[strings.ReplaceAll(rel, string(filepath.Separator), "")] {
+			return nil
+		}
+		// Content that was stored just now may belong to an edit that's
+		// still in progress.
+		if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) > time.Hour {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+func writeAtomically(path string, data []byte, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
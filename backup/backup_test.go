@@ -0,0 +1,289 @@
+package backup_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/backup"
+)
+
+type testRunner struct{}
+
+func (testRunner) Context() context.Context { return context.Background() }
+func (testRunner) Report(string)            {}
+
+type writeParams struct {
+	Path string `json:"path"`
+	Text string `json:"text"`
+}
+
+// splice stands in for splice_file, replacing the whole file.
+var splice = tools.Func("Write", "Write the file", "splice_file", func(r tools.Runner, p writeParams) tools.Result {
+	if err := os.WriteFile(p.Path, []byte(p.Text), 0644); err != nil {
+		return tools.ErrorWithLabel("Write", err)
+	}
+	return tools.SuccessWithLabel("Write", nil)
+})
+
+func run(t *testing.T, tool tools.Tool, params any) tools.Result {
+	t.Helper()
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tool.Run(testRunner{}, data)
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	store := backup.NewStore(filepath.Join(dir, "backups"), backup.Retention{MaxAgeDays: 30, MaxSizeMB: 10})
+	turn := 1
+	track := store.Track(func() (string, int) { return "session", turn })
+	write := track(splice)
+
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, write, writeParams{a, "first"})
+	turn = 2
+	run(t, write, writeParams{a, "second"})
+	run(t, write, writeParams{a, "third"})
+	run(t, write, writeParams{b, "new"})
+	// Unchanged files aren't recorded.
+	run(t, write, writeParams{b, "new"})
+
+	entries, err := store.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Path != a || e.Session != "session" || e.Turn != 1 || e.Tool != "splice_file" || e.Size != 8 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if last, _ := store.LastTurn("session"); last != 2 {
+		t.Errorf("expected the last turn to be 2, got %d", last)
+	}
+
+	undone, paths, err := store.Undo("session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone != 2 || len(paths) != 2 {
+		t.Errorf("expected both files of turn 2 to be reverted, got turn %d: %q", undone, paths)
+	}
+	if got := read(t, a); got != "first" {
+		t.Errorf("expected %q, got %q", "first", got)
+	}
+	if _, err := os.Stat(b); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the new file to be removed, got %v", err)
+	}
+
+	if undone, _, err = store.Undo("session"); err != nil || undone != 1 {
+		t.Fatalf("expected turn 1 to be undone next, got %d: %v", undone, err)
+	}
+	if got := read(t, a); got != "original" {
+		t.Errorf("expected %q, got %q", "original", got)
+	}
+	if _, _, err = store.Undo("session"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("expected nothing left to undo, got %v", err)
+	}
+	if _, _, err = store.Undo("other"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("expected nothing to undo in another session, got %v", err)
+	}
+
+	// Undone changes can still be restored.
+	e, err := store.Find(entries[2].Version(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := store.Restore(a, e, "", 0, backup.ToolRestore); err != nil || !changed {
+		t.Fatalf("expected the file to be restored, got %v", err)
+	}
+	if got := read(t, a); got != "second" {
+		t.Errorf("expected %q, got %q", "second", got)
+	}
+}
+
+func TestUndoSkipsTurnsWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	store := backup.NewStore(filepath.Join(dir, "backups"), backup.Retention{})
+	turn := 1
+	write := store.Track(func() (string, int) { return "session", turn })(splice)
+
+	path := filepath.Join(dir, "a.txt")
+	run(t, write, writeParams{path, "turn 1"})
+	// Turns 2, 4 and 5 only chat.
+	turn = 3
+	run(t, write, writeParams{path, "turn 3"})
+	turn = 6
+	run(t, write, writeParams{path, "turn 6"})
+
+	for _, want := range []struct {
+		turn    int
+		content string
+	}{{6, "turn 3"}, {3, "turn 1"}} {
+		undone, _, err := store.Undo("session")
+		if err != nil || undone != want.turn {
+			t.Fatalf("expected turn %d to be undone, got %d: %v", want.turn, undone, err)
+		}
+		if got := read(t, path); got != want.content {
+			t.Errorf("expected %q, got %q", want.content, got)
+		}
+	}
+	if undone, _, err := store.Undo("session"); err != nil || undone != 1 {
+		t.Fatalf("expected turn 1 to be undone, got %d: %v", undone, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the file created in turn 1 to be removed, got %v", err)
+	}
+	if _, _, err := store.Undo("session"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("expected nothing left to undo, got %v", err)
+	}
+}
+
+func TestRestoreTool(t *testing.T) {
+	dir := t.TempDir()
+	store := backup.NewStore(filepath.Join(dir, "backups"), backup.Retention{})
+	track := store.Track(func() (string, int) { return "session", 1 })
+	write, restore := track(splice), track(store.Tool())
+
+	path := filepath.Join(dir, "notes.txt")
+	result := run(t, restore, map[string]string{"path": path})
+	if result.Error() == nil {
+		t.Error("expected an error for a file without backups")
+	}
+	run(t, write, writeParams{path, "one"})
+	run(t, write, writeParams{path, "two"})
+	run(t, write, writeParams{path, "three"})
+
+	result = run(t, restore, map[string]string{"path": path})
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := read(t, path); got != "two" {
+		t.Errorf("expected the version before the last change, got %q", got)
+	}
+
+	versions, err := store.Versions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 4 || versions[0].Tool != "restore_file_version" {
+		t.Fatalf("expected the restore to be backed up too, got %+v", versions)
+	}
+	one := versions[len(versions)-2]
+	result = run(t, restore, map[string]string{"path": path, "version": one.Version()})
+	if err := result.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := read(t, path); got != "one" {
+		t.Errorf("expected %q, got %q", "one", got)
+	}
+
+	result = run(t, restore, map[string]string{"path": path, "version": "ffffffffffff"})
+	if result.Error() == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+func TestTrackFailedCall(t *testing.T) {
+	dir := t.TempDir()
+	store := backup.NewStore(filepath.Join(dir, "backups"), backup.Retention{})
+	write := store.Track(func() (string, int) { return "session", 1 })(splice)
+	run(t, write, writeParams{filepath.Join(dir, "missing", "file.txt"), "text"})
+	if entries, err := store.Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("expected failed calls not to be recorded, got %+v: %v", entries, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	write := backup.NewStore(backups, backup.Retention{}).Track(func() (string, int) { return "", 0 })(splice)
+	path := filepath.Join(dir, "big.txt")
+	for _, c := range "abcd" {
+		run(t, write, writeParams{path, strings.Repeat(string(c), 400_000)})
+	}
+	entries, err := backup.NewStore(backups, backup.Retention{}).Entries()
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d: %v", len(entries), err)
+	}
+	// Content that was stored in the last hour is never removed, in case it
+	// belongs to an edit in progress.
+	old := time.Now().Add(-2 * time.Hour)
+	filepath.WalkDir(filepath.Join(backups, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			os.Chtimes(path, old, old)
+		}
+		return nil
+	})
+
+	// Pruning happens when the first backup is saved, and keeps the newest
+	// backups that fit.
+	store := backup.NewStore(backups, backup.Retention{MaxAgeDays: 30, MaxSizeMB: 1})
+	write = store.Track(func() (string, int) { return "", 0 })(splice)
+	run(t, write, writeParams{path, "small"})
+	entries, err = store.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Size != 400_000 || read(t, path) != "small" {
+		t.Fatalf("expected the 2 newest entries to be kept, got %+v", entries)
+	}
+	var objects int
+	filepath.WalkDir(filepath.Join(backups, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			objects++
+		}
+		return nil
+	})
+	if objects != 2 {
+		t.Errorf("expected the content of the pruned entries to be removed, got %d objects", objects)
+	}
+}
+
+func TestEntriesBrokenLine(t *testing.T) {
+	dir := t.TempDir()
+	store := backup.NewStore(filepath.Join(dir, "backups"), backup.Retention{})
+	write := store.Track(func() (string, int) { return "session", 1 })(splice)
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, write, writeParams{path, "one"})
+	index, err := os.OpenFile(filepath.Join(dir, "backups", "index.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.WriteString(`{"time": "2026-` + "\n")
+	index.Close()
+	run(t, write, writeParams{path, "two"})
+
+	if entries, err := store.Entries(); err != nil || len(entries) != 2 {
+		t.Fatalf("expected the broken line to be skipped, got %+v: %v", entries, err)
+	}
+	if undone, _, err := store.Undo("session"); err != nil || undone != 1 || read(t, path) != "original" {
+		t.Errorf("expected turn 1 to be undone, got %d: %v", undone, err)
+	}
+}
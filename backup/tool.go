@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Editing lists the tools that change files, with the name of the parameter
+// that holds the path of the file.
+var Editing = map[string]string{
+	"splice_file":          "path",
+	"restore_file_version": "path",
+}
+
+// Track returns a middleware that backs up the files that the tools in
+// Editing are about to change, recording the changes under the session and
+// turn returned by turn.
+func (s *Store) Track(turn func() (session string, turn int)) func(tools.Tool) tools.Tool {
+	return func(t tools.Tool) tools.Tool {
+		key, ok := Editing[t.FuncName()]
+		if !ok {
+			return t
+		}
+		return &trackedTool{Tool: t, store: s, key: key, turn: turn}
+	}
+}
+
+type trackedTool struct {
+	tools.Tool
+	store *Store
+	key   string
+	turn  func() (string, int)
+}
+
+func (t *trackedTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	var fields map[string]any
+	json.Unmarshal(params, &fields)
+	p, _ := fields[t.key].(string)
+	if p == "" {
+		return t.Tool.Run(r, params)
+	}
+	path := ResolvePath(p)
+	before, err := read(path)
+	if err == nil {
+		err = t.store.store(before)
+	}
+	if err != nil {
+		return tools.ErrorWithLabel(p, fmt.Errorf("failed to create backup: %w", err))
+	}
+	result := t.Tool.Run(r, params)
+	if result.Error() != nil {
+		return result
+	}
+	if after, err := read(path); err == nil && after.equal(before) {
+		return result
+	}
+	session, turn := t.turn()
+	if err := t.store.record(path, before, session, turn, t.FuncName()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to record the backup of %s: %v\n", path, err)
+	}
+	return result
+}
+
+// ResolvePath returns the absolute path that a tool would use for p.
+func ResolvePath(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		home, _ := os.UserHomeDir()
+		p = filepath.Join(home, p[2:])
+	}
+	p = os.ExpandEnv(p)
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+type RestoreFileVersionParams struct {
+	Path    string `json:"path" description:"The path to the file to restore."`
+	Version string `json:"version,omitempty" description:"The version to restore, as listed in an earlier result of this tool. Defaults to the version from before the file was last changed."`
+}
+
+// Tool returns a tool that lets the model restore earlier versions of the
+// files it edited. The file's current content is backed up too, as long as
+// the tool is tracked (see Track).
+func (s *Store) Tool() tools.Tool {
+	return tools.Func(
+		"Restore file version",
+		"Restore a file that you changed to an earlier version, such as the content it had before your last edit. The result lists the other versions of the file that can be restored.",
+		"restore_file_version",
+		func(r tools.Runner, p RestoreFileVersionParams) tools.Result {
+			r.Report(fmt.Sprintf("Restoring file (%s)", filepath.Base(p.Path)))
+			path := ResolvePath(p.Path)
+			versions, err := s.Versions(path)
+			if err != nil {
+				return tools.ErrorWithLabel(p.Path, err)
+			}
+			var e Entry
+			if p.Version == "" {
+				for _, v := range versions {
+					if v.Hash != "" {
+						e = v
+						break
+					}
+				}
+				if e.Hash == "" {
+					return tools.ErrorWithLabel(p.Path, fmt.Errorf("there are no earlier versions of %q", p.Path))
+				}
+			} else if e, err = s.Find(p.Version, path); errors.Is(err, ErrNotFound) {
+				return tools.ErrorWithLabel(p.Path, fmt.Errorf("there's no version %q of %q", p.Version, p.Path))
+			} else if err != nil {
+				return tools.ErrorWithLabel(p.Path, err)
+			}
+			data, err := s.Read(e)
+			if err != nil {
+				return tools.ErrorWithLabel(p.Path, err)
+			}
+			mode := e.Mode
+			if info, err := os.Stat(path); err == nil {
+				mode = info.Mode().Perm()
+			} else if mode == 0 {
+				mode = 0644
+			}
+			// The tracking middleware backs up the current content.
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return tools.ErrorWithLabel(p.Path, err)
+			}
+			if err := writeAtomically(path, data, mode); err != nil {
+				return tools.ErrorWithLabel(p.Path, fmt.Errorf("failed to restore %q: %w", p.Path, err))
+			}
+			return tools.SuccessWithLabel(fmt.Sprintf("Restored %q to version %s", p.Path, e.Version()), map[string]any{
+				"path":     p.Path,
+				"version":  e.Version(),
+				"from":     e.Time.Format(time.RFC3339),
+				"versions": describe(versions, e.Hash, time.Now()),
+			})
+		},
+	)
+}
+
+// describe lists the versions for the model, except the one with hash.
+func describe(versions []Entry, hash string, now time.Time) []string {
+	var lines []string
+	// Versions without content are from before the file was created.
+	seen := map[string]bool{hash: true, "": true}
+	for _, e := range versions {
+		if seen[e.Hash] {
+			continue
+		}
+		seen[e.Hash] = true
+		if len(lines) == 10 {
+			lines = append(lines, "…and older versions")
+			break
+		}
+		lines = append(lines, fmt.Sprintf("version %s, %d bytes, from before a change %s ago", e.Version(), e.Size, now.Sub(e.Time).Round(time.Second)))
+	}
+	return lines
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blixt/first-aid/backup"
+	"github.com/blixt/first-aid/config"
+)
+
+// backupStore returns the store of the versions of files that first-aid
+// changed.
+func backupStore(cfg *config.Config) *backup.Store {
+	return backup.NewStore(filepath.Join(config.DataDir(), "backups"), cfg.Backups)
+}
+
+// runBackups lists the backups or restores one, depending on args, and
+// returns the exit code.
+func runBackups(cfg *config.Config, args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: first-aid backups list [flags] [file]")
+		fmt.Fprintln(os.Stderr, "       first-aid backups restore <version> [file]")
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	store := backupStore(cfg)
+	switch args[0] {
+	case "list":
+		return listBackups(store, args[1:])
+	case "restore":
+		if len(args) < 2 || len(args) > 3 {
+			usage()
+			return 2
+		}
+		path := ""
+		if len(args) == 3 {
+			path = backup.ResolvePath(args[2])
+		}
+		return restoreBackup(store, args[1], path)
+	default:
+		usage()
+		return 2
+	}
+}
+
+func listBackups(store *backup.Store, args []string) int {
+	fs := flag.NewFlagSet("backups list", flag.ContinueOnError)
+	session := fs.String("session", "", "Only show the changes made in this session")
+	limit := fs.Int("limit", 50, "Show at most this many of the most recent changes (0 means all)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: first-aid backups list [flags] [file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	entries, err := store.Entries()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	path := ""
+	if fs.NArg() == 1 {
+		path = backup.ResolvePath(fs.Arg(0))
+	}
+	entries = slices.DeleteFunc(entries, func(e backup.Entry) bool {
+		return (*session != "" && e.Session != *session) || (path != "" && e.Path != path)
+	})
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No backups found in %s.\n", store.Dir())
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tCHANGED\tSESSION\tTURN\tCHANGED BY\tBYTES\tFILE")
+	for _, e := range entries {
+		version, size := e.Version(), fmt.Sprint(e.Size)
+		if version == "" {
+			version, size = "(new file)", "-"
+		}
+		session, turn := e.Session, fmt.Sprint(e.Turn)
+		if session == "" {
+			session, turn = "-", "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", version, e.Time.Local().Format(time.DateTime), session, turn, e.Tool, size, displayPath(e.Path))
+	}
+	tw.Flush()
+	return 0
+}
+
+// restoreBackup restores the version of a file, to path if it isn't empty
+// and otherwise to where the file was.
+func restoreBackup(store *backup.Store, version, path string) int {
+	e, err := store.Find(version, "")
+	if errors.Is(err, backup.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "There's no version %q (see first-aid backups list).\n", version)
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if path == "" {
+		path = e.Path
+	}
+	changed, err := store.Restore(path, e, "", 0, backup.ToolRestore)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !changed {
+		fmt.Printf("%s is already at version %s.\n", displayPath(path), e.Version())
+		return 0
+	}
+	fmt.Printf("Restored %s to version %s, as it was before %s.\n", displayPath(path), e.Version(), e.Time.Local().Format(time.DateTime))
+	return 0
+}
@@ -3,6 +3,7 @@ package chromecontrol
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 
 	"github.com/gorilla/websocket"
@@ -32,7 +33,7 @@ func (s *session) handleMessages() {
 
 		var result rpcResult
 		if err := json.Unmarshal(message, &result); err != nil {
-			fmt.Println("Unmarshal error:", err)
+			fmt.Fprintln(os.Stderr, "Unmarshal error:", err)
 			continue
 		}
 
@@ -41,7 +42,7 @@ func (s *session) handleMessages() {
 			select {
 			case ch <- result:
 			default:
-				fmt.Println("Warning: result channel is full, discarding result")
+				fmt.Fprintln(os.Stderr, "Warning: result channel is full, discarding result")
 			}
 			delete(s.pending, result.ID)
 		}
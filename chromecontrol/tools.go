@@ -30,7 +30,16 @@ type SearchWebParams struct {
 	Background bool   `json:"background,omitempty"`
 }
 
+// AddToolsToLLM adds all the browser tools to the LLM.
 func (s *Server) AddToolsToLLM(model *llms.LLM) {
+	for _, t := range s.Tools() {
+		model.AddTool(t)
+	}
+}
+
+// Tools returns the tools for controlling the browser through this server.
+func (s *Server) Tools() []tools.Tool {
+	var list []tools.Tool
 	var t tools.Tool
 
 	t = tools.Func("List browser tabs", "List info about the tabs in the browser, including their ids", "browser_list_tabs", func(r tools.Runner, params ListTabsParams) tools.Result {
@@ -44,7 +53,7 @@ func (s *Server) AddToolsToLLM(model *llms.LLM) {
 		}
 		return tools.SuccessWithLabel("List browser tabs", string(jsonData))
 	})
-	model.AddTool(t)
+	list = append(list, t)
 
 	t = tools.Func("Set active browser tab", "Switch to the browser tab with the specified id", "browser_set_active_tab", func(r tools.Runner, params SetActiveTabParams) tools.Result {
 		err := s.SetActiveTab(params.ID)
@@ -53,7 +62,7 @@ func (s *Server) AddToolsToLLM(model *llms.LLM) {
 		}
 		return tools.SuccessWithLabel("Set active tab", "Tab set successfully")
 	})
-	model.AddTool(t)
+	list = append(list, t)
 
 	t = tools.Func("Open new tab", "Open a new tab in the browser", "browser_open_tab", func(r tools.Runner, params OpenTabParams) tools.Result {
 		r.Report(fmt.Sprintf("Opening new tab (%s)", params.URL))
@@ -69,7 +78,7 @@ func (s *Server) AddToolsToLLM(model *llms.LLM) {
 		}
 		return tools.SuccessWithLabel("Open new tab", content)
 	})
-	model.AddTool(t)
+	list = append(list, t)
 
 	t = tools.Func("Look at browser tab", "Activate and take a screenshot of the specified tab in the browser", "browser_screenshot_tab", func(r tools.Runner, params ScreenshotTabParams) tools.Result {
 		dataURI, err := s.ScreenshotTab(params.ID)
@@ -79,7 +88,7 @@ func (s *Server) AddToolsToLLM(model *llms.LLM) {
 		content := content.Content{&content.ImageURL{URL: dataURI}}
 		return tools.SuccessWithContent("Screenshot browser tab", content)
 	})
-	model.AddTool(t)
+	list = append(list, t)
 
 	t = tools.Func("Search the web", "Search the web using the default search provider", "browser_search_web", func(r tools.Runner, params SearchWebParams) tools.Result {
 		tabID, err := s.SearchWeb(params.Query, params.Background)
@@ -94,5 +103,7 @@ func (s *Server) AddToolsToLLM(model *llms.LLM) {
 		}
 		return tools.SuccessWithLabel("Search the web", content)
 	})
-	model.AddTool(t)
+	list = append(list, t)
+
+	return list
 }
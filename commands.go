@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/backup"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/session"
+)
+
+// command is a slash command that can be typed at the prompt instead of a
+// message to the LLM.
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(a *app, args []string) error
+	// complete returns the possible completions of the argument currently
+	// being typed, given the arguments before it.
+	complete func(a *app, args []string) []string
+}
+
+var commands []command
+
+func init() {
+	// This is assigned in init since /help refers to the list itself.
+	commands = []command{
+		{name: "/clear", help: "Forget the conversation and start a new session", run: clearCommand},
+		{name: "/compact", help: "Summarize older parts of the conversation to free up context", run: compactCommand},
+		{name: "/model", usage: "[provider] [model]", help: "Show or switch the model, keeping the conversation", run: modelCommand, complete: completeModel},
+		{name: "/tools", usage: "[enable|disable <tool>]", help: "List the tools, or enable or disable one", run: toolsCommand, complete: completeTools},
+		{name: "/undo", help: "Revert the changes to files made in the last turn", run: undoCommand},
+		{name: "/save", usage: "<file>", help: "Save the conversation as Markdown (or JSON if the file ends in .json)", run: saveCommand},
+		{name: "/system", help: "Show the current system prompt", run: systemCommand},
+		{name: "/cost", help: "Show the tokens used and their estimated cost", run: costCommand},
+		{name: "/help", help: "Show this list", run: helpCommand},
+	}
+}
+
+// isCommand reports whether the input should be handled as a slash command.
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), "/")
+}
+
+// runCommand runs the slash command in the input and prints its output.
+func runCommand(a *app, input string) {
+	fields := strings.Fields(input)
+	for _, cmd := range commands {
+		if cmd.name != fields[0] {
+			continue
+		}
+		if err := cmd.run(a, fields[1:]); err != nil {
+			fmt.Printf("❌ %s\n", err)
+		}
+		return
+	}
+	fmt.Printf("❌ Unknown command %s (try /help)\n", fields[0])
+}
+
+// completeCommand is the completer for the prompt.
+func completeCommand(a *app, line string) []string {
+	if !isCommand(line) {
+		return nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 1 && !strings.HasSuffix(line, " ") {
+		var names []string
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd.name, fields[0]) {
+				names = append(names, cmd.name)
+			}
+		}
+		return names
+	}
+	for _, cmd := range commands {
+		if cmd.name != fields[0] || cmd.complete == nil {
+			continue
+		}
+		// Complete the last argument, or a new one if the line ends in a space.
+		prefix, args := "", fields[1:]
+		if !strings.HasSuffix(line, " ") {
+			prefix, args = args[len(args)-1], args[:len(args)-1]
+		}
+		head := strings.Join(append([]string{cmd.name}, args...), " ") + " "
+		var lines []string
+		for _, candidate := range cmd.complete(a, args) {
+			if strings.HasPrefix(candidate, prefix) {
+				lines = append(lines, head+candidate)
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+func clearCommand(a *app, args []string) error {
+	a.ai.SetMessages(nil)
+	a.sess = session.New()
+	a.usage.Reset()
+	a.turn = 0
+	fmt.Printf("Forgot everything. Started session %s.\n", a.sess.ID)
+	return nil
+}
+
+func modelCommand(a *app, args []string) error {
+	var provider, model string
+	switch len(args) {
+	case 0:
+		fmt.Printf("Using %s (%s).\n", a.cfg.Model, a.cfg.Provider)
+		return nil
+	case 1:
+		if _, ok := config.DefaultModels[strings.ToLower(args[0])]; ok {
+			provider = args[0]
+		} else {
+			model = args[0]
+		}
+	case 2:
+		provider, model = args[0], args[1]
+	default:
+		return fmt.Errorf("usage: /model [provider] [model]")
+	}
+	cfg, err := a.cfg.WithModel(provider, model)
+	if err != nil {
+		return err
+	}
+	p, err := newProvider(cfg)
+	if err != nil {
+		return err
+	}
+	a.cfg = cfg
+	a.ai.SetProvider(p)
+	a.usage.SetPrice(cfg.Price())
+	fmt.Printf("Switched to %s (%s).\n", cfg.Model, cfg.Provider)
+	return nil
+}
+
+func completeModel(a *app, args []string) []string {
+	if len(args) > 1 {
+		return nil
+	}
+	var candidates []string
+	if len(args) == 0 {
+		for provider := range config.DefaultModels {
+			candidates = append(candidates, provider)
+		}
+	}
+	for provider, model := range config.DefaultModels {
+		if len(args) == 0 || args[0] == provider {
+			candidates = append(candidates, model)
+		}
+	}
+	if len(args) == 0 && !slices.Contains(candidates, a.cfg.Model) {
+		candidates = append(candidates, a.cfg.Model)
+	}
+	slices.Sort(candidates)
+	return candidates
+}
+
+func toolsCommand(a *app, args []string) error {
+	if len(args) == 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, t := range a.ai.Tools() {
+			state := "enabled"
+			if !a.ai.ToolEnabled(t.FuncName()) {
+				state = "disabled"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", t.FuncName(), state, t.Label())
+		}
+		return tw.Flush()
+	}
+	if len(args) != 2 || (args[0] != "enable" && args[0] != "disable") {
+		return fmt.Errorf("usage: /tools [enable|disable <tool>]")
+	}
+	if err := a.ai.SetToolEnabled(args[1], args[0] == "enable"); err != nil {
+		return err
+	}
+	fmt.Printf("Tool %s is now %sd.\n", args[1], args[0])
+	return nil
+}
+
+func completeTools(a *app, args []string) []string {
+	switch len(args) {
+	case 0:
+		return []string{"enable", "disable"}
+	case 1:
+		var names []string
+		for _, t := range a.ai.Tools() {
+			if a.ai.ToolEnabled(t.FuncName()) == (args[0] == "disable") {
+				names = append(names, t.FuncName())
+			}
+		}
+		return names
+	default:
+		return nil
+	}
+}
+
+func saveCommand(a *app, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: /save <file>")
+	}
+	messages := a.ai.Messages()
+	var data []byte
+	if strings.EqualFold(filepath.Ext(args[0]), ".json") {
+		var err error
+		data, err = json.MarshalIndent(messages, "", "  ")
+		if err != nil {
+			return err
+		}
+	} else {
+		data = []byte(transcriptMarkdown(messages))
+	}
+	if err := os.WriteFile(args[0], data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d messages to %s.\n", len(messages), args[0])
+	return nil
+}
+
+func systemCommand(a *app, args []string) error {
+	fmt.Println(contentText(a.ai.SystemPrompt()))
+	return nil
+}
+
+func costCommand(a *app, args []string) error {
+	s := a.usage.Summary()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "\tLast turn\tSession\n")
+	fmt.Fprintf(tw, "Input tokens\t%d\t%d\n", s.Turn.Input, s.Session.Input)
+	fmt.Fprintf(tw, "Cached input tokens\t%d\t%d\n", s.Turn.CachedInput, s.Session.CachedInput)
+	fmt.Fprintf(tw, "Output tokens\t%d\t%d\n", s.Turn.Output, s.Session.Output)
+	fmt.Fprintf(tw, "Thinking tokens (estimated)\t%d\t%d\n", s.Turn.Thinking, s.Session.Thinking)
+	if s.PriceKnown {
+		fmt.Fprintf(tw, "Estimated cost\t$%.4f\t$%.4f\n", s.TurnCost, s.SessionCost)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !s.PriceKnown {
+		fmt.Printf("No price is known for %s (%s), so the cost can't be estimated. Add it to \"prices\" in the config.\n", a.cfg.Model, a.cfg.Provider)
+	}
+	if budget := a.usage.Budget; budget.MaxUSD > 0 {
+		fmt.Printf("Budget: $%.2f per session (%s when exceeded).\n", budget.MaxUSD, budget.Action)
+	}
+	return nil
+}
+
+func compactCommand(a *app, args []string) error {
+	fmt.Println("Summarizing the conversation...")
+	before, after, err := a.ai.Compact(context.Background())
+	a.save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Shrunk the conversation from about %d to %d tokens.\n", before, after)
+	return nil
+}
+
+func undoCommand(a *app, args []string) error {
+	turn, paths, err := a.backups.Undo(a.sess.ID)
+	if errors.Is(err, backup.ErrNotFound) {
+		fmt.Println("No changes to files to undo in this session.")
+		return nil
+	}
+	for _, path := range paths {
+		fmt.Printf("↩️ Reverted %s\n", displayPath(path))
+	}
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Printf("The files changed in turn %d were already back to how they were.\n", turn)
+	} else {
+		fmt.Printf("Undid the changes to files made in turn %d. The conversation still mentions them, so say so if it matters.\n", turn)
+	}
+	return nil
+}
+
+// displayPath returns path relative to the current directory if it's inside
+// it.
+func displayPath(path string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// truncate returns s shortened to n characters, ending with an ellipsis, if
+// it's longer than that.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	end := 0
+	for range n - 1 {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	return s[:end] + "…"
+}
+
+func helpCommand(a *app, args []string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "%s %s\t%s\n", cmd.name, cmd.usage, cmd.help)
+	}
+	fmt.Fprintf(tw, "exit\tQuit\n")
+	return tw.Flush()
+}
+
+// contentText returns the text representation of content, with placeholders
+// for anything that isn't text.
+func contentText(c content.Content) string {
+	var parts []string
+	for _, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			parts = append(parts, item.Text)
+		case *content.JSON:
+			parts = append(parts, string(item.Data))
+		case *content.ImageURL:
+			parts = append(parts, "[image]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// transcriptMarkdown renders the conversation as a Markdown document.
+func transcriptMarkdown(messages []llms.Message) string {
+	var sb strings.Builder
+	sb.WriteString("# First Aid transcript\n")
+	for _, m := range messages {
+		text := strings.TrimSpace(contentText(m.Content))
+		switch {
+		case m.ToolCallID != "":
+			text = truncate(text, 2_000)
+			fmt.Fprintf(&sb, "\n```\n%s\n```\n", text)
+		case m.Role == "user":
+			fmt.Fprintf(&sb, "\n## User\n\n%s\n", text)
+		default:
+			if text != "" {
+				fmt.Fprintf(&sb, "\n## First Aid\n\n%s\n", text)
+			}
+			for _, call := range m.ToolCalls {
+				fmt.Fprintf(&sb, "\n🔧 `%s` `%s`\n", call.Name, call.Arguments)
+			}
+		}
+	}
+	return sb.String()
+}
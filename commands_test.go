@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/llmtest"
+	"github.com/blixt/first-aid/usage"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 5, "too …"},
+		{"åäö and more", 4, "åäö…"},
+		{"🩹🩹🩹🩹", 3, "🩹🩹…"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d): expected %q, got %q", tt.s, tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestTranscriptMarkdownLongToolResult(t *testing.T) {
+	// Multi-byte characters that a byte limit would cut in half.
+	output := "x" + strings.Repeat("ö", 3_000)
+	md := transcriptMarkdown([]llms.Message{{Role: "tool", ToolCallID: "1", Content: content.FromText(output)}})
+	if !strings.Contains(md, "x"+strings.Repeat("ö", 1_998)+"…\n") || !utf8.ValidString(md) {
+		t.Errorf("expected the tool result to be cut at a character, got %q", md[len(md)-20:])
+	}
+}
+
+func TestClearCommandResetsUsage(t *testing.T) {
+	provider := llmtest.NewProvider(t,
+		llmtest.Response{llmtest.Text("Hi."), llmtest.Usage(1_000, 100)},
+		llmtest.Response{llmtest.Text("Hello again."), llmtest.Usage(50, 5)},
+	)
+	a := newTestApp(t, provider)
+	runTurn(a, "hi")
+	old := a.sess.ID
+	if err := clearCommand(a, nil); err != nil {
+		t.Fatal(err)
+	}
+	runTurn(a, "hi again")
+	if a.sess.ID == old {
+		t.Fatal("expected a new session")
+	}
+
+	saved, err := a.store.Load(a.sess.ID)
+	if err != nil {
+		t.Fatalf("expected the session to be saved: %v", err)
+	}
+	if want := (usage.Tokens{Input: 50, Output: 5}); saved.Usage != want {
+		t.Errorf("expected only the usage of the last turn %+v, got %+v", want, saved.Usage)
+	}
+}
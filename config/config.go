@@ -0,0 +1,557 @@
+// Package config loads the settings for first-aid. Settings come from a
+// user-level JSON config file, then environment variables, then command line
+// flags, with later sources overriding earlier ones.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blixt/first-aid/backup"
+	"github.com/blixt/first-aid/prompt"
+	"github.com/blixt/first-aid/usage"
+)
+
+type Config struct {
+	// Provider is the LLM provider to use ("anthropic", "openai" or "google").
+	Provider string `json:"provider,omitempty"`
+	// Model is the provider specific model name. Defaults to a sensible model
+	// for the selected provider.
+	Model string `json:"model,omitempty"`
+	// Betas are provider beta features to enable (only used by Anthropic). If
+	// left unset, the betas that first-aid was built for are used. Use an
+	// empty list to disable all betas.
+	Betas []string `json:"betas,omitempty"`
+	// ThinkingBudget is the number of tokens the model may spend on thinking
+	// (only used by Anthropic). Zero disables thinking.
+	ThinkingBudget *int `json:"thinkingBudget,omitempty"`
+	// APIKeyEnv is the name of the environment variable holding the API key.
+	// Defaults to the provider's conventional variable, e.g. ANTHROPIC_API_KEY.
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// APIKeyFile is a path to a file containing the API key. If set, it takes
+	// precedence over APIKeyEnv.
+	APIKeyFile string `json:"apiKeyFile,omitempty"`
+	// MaxRetries is the number of times a request that failed with a
+	// retryable error (e.g. rate limits) is retried. Defaults to 4.
+	MaxRetries *int `json:"maxRetries,omitempty"`
+	// CompactAfterTokens is the estimated size of the conversation above
+	// which older turns are summarized before the next turn. Zero disables
+	// compaction. Defaults to 100,000.
+	CompactAfterTokens *int `json:"compactAfterTokens,omitempty"`
+	// Prices overrides and extends the built-in price table, keyed by
+	// "provider/model" or just "model", in USD per million tokens.
+	Prices usage.Prices `json:"prices,omitempty"`
+	// Prompt is the prompt profile that sets the assistant's persona: the
+	// name of a built-in profile or one in the prompts directory of the
+	// config directory, or the path of a template file. Defaults to "marvin".
+	Prompt string `json:"prompt,omitempty"`
+	// Budget limits the estimated cost of a session.
+	Budget usage.Budget `json:"budget,omitempty"`
+
+	EnableOnvifCamera   bool `json:"enableOnvifCamera,omitempty"`
+	EnableChromeControl bool `json:"enableChromeControl,omitempty"`
+	// DelegateTools are the tools that sub-agents started with the
+	// delegate_task tool may use. If left unset, tools for inspecting the
+	// machine and running commands are allowed. Use an empty list to disable
+	// delegation.
+	DelegateTools []string `json:"delegateTools,omitempty"`
+	// MCPServers are Model Context Protocol servers, keyed by name, whose
+	// tools are offered to the LLM.
+	MCPServers map[string]MCPServer `json:"mcpServers,omitempty"`
+
+	// ServeAddr is the address that `first-aid serve` listens on. Defaults to
+	// localhost only; use e.g. "0.0.0.0:8765" to allow other devices.
+	ServeAddr string `json:"serveAddr,omitempty"`
+	// ServeToken is the bearer token that clients of `first-aid serve` must
+	// send. If empty, a random token is generated on startup.
+	ServeToken string `json:"serveToken,omitempty"`
+
+	// ApprovalPolicy is the path to the file of allow and deny rules for
+	// tool calls. Defaults to policy.json in the config directory.
+	ApprovalPolicy string `json:"approvalPolicy,omitempty"`
+	// ApproveAll approves all tool calls that the policy doesn't deny. It can
+	// only be set with the --yes flag.
+	ApproveAll bool `json:"-"`
+	// AuditLog is the path to the log of every tool call. Defaults to
+	// audit.jsonl in the data directory.
+	AuditLog string `json:"auditLog,omitempty"`
+	// RedactSecrets hides secrets such as API keys, tokens and private keys
+	// in tool results from the model. Defaults to true.
+	RedactSecrets *bool `json:"redactSecrets,omitempty"`
+	// RedactPatterns are regular expressions for more secrets to hide. If a
+	// pattern has a capture group, only what the group matches is hidden.
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+	// Backups limits how long the earlier versions of files that first-aid
+	// edits are kept.
+	Backups backup.Retention `json:"backups,omitempty"`
+
+	// JSONOutput makes first-aid print updates as JSON lines instead of text.
+	// It can only be set with the --json flag.
+	JSONOutput bool `json:"-"`
+	// Resume is the id (or id prefix) of the session to continue. It can
+	// only be set with the --resume flag.
+	Resume string `json:"-"`
+	// Continue continues the latest session in the current directory. It can
+	// only be set with the --continue flag.
+	Continue bool `json:"-"`
+	// Record is the path of a fixture file to record the session to. It can
+	// only be set with the --record flag.
+	Record string `json:"-"`
+	// Replay is the path of a fixture file to replay offline, with both the
+	// model's responses and the tool results taken from the recording. It can
+	// only be set with the --replay flag.
+	Replay string `json:"-"`
+	// ReplayTools is like Replay, but only takes the tool results from the
+	// recording and talks to the configured model, for trying prompt changes
+	// against a recorded session. It can only be set with the --replay-tools
+	// flag.
+	ReplayTools string `json:"-"`
+}
+
+// MCPServer is an MCP server that first-aid starts and talks to over stdio.
+type MCPServer struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// Trusted servers' tools run without asking for approval. Otherwise,
+	// they're treated like the tools that can change the machine.
+	Trusted  bool `json:"trusted,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+	ProviderGoogle    = "google"
+)
+
+const (
+	defaultThinkingBudget = 1024
+	defaultMaxRetries     = 4
+	defaultCompactAfter   = 100_000
+	defaultServeAddr      = "127.0.0.1:8765"
+	defaultBackupDays     = 30
+	defaultBackupMB       = 500
+)
+
+var DefaultModels = map[string]string{
+	ProviderAnthropic: "claude-sonnet-4-20250514",
+	ProviderOpenAI:    "gpt-4o",
+	ProviderGoogle:    "gemini-1.5-pro-001",
+}
+
+var defaultAPIKeyEnvs = map[string]string{
+	ProviderAnthropic: "ANTHROPIC_API_KEY",
+	ProviderOpenAI:    "OPENAI_API_KEY",
+	ProviderGoogle:    "GOOGLE_API_KEY",
+}
+
+var defaultDelegateTools = []string{
+	"list_files",
+	"slice_file",
+	"look_at_image",
+	"run_shell_cmd",
+	"run_python",
+	"run_powershell_cmd",
+	"run_apple_script",
+}
+
+var defaultBetas = map[string][]string{
+	ProviderAnthropic: {
+		"interleaved-thinking-2025-05-14",
+		"fine-grained-tool-streaming-2025-05-14",
+	},
+}
+
+// Dir returns the directory holding first-aid's user-level files.
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "first-aid")
+}
+
+// DataDir returns the directory where first-aid stores data such as sessions.
+// It follows XDG_DATA_HOME on Linux and uses the config directory elsewhere.
+func DataDir() string {
+	if dir := os.Getenv("FIRST_AID_DATA_DIR"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "linux" {
+		dir := os.Getenv("XDG_DATA_HOME")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return Dir()
+			}
+			dir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dir, "first-aid")
+	}
+	return Dir()
+}
+
+// PromptsDir returns the directory holding the user's prompt profiles.
+func PromptsDir() string {
+	return filepath.Join(Dir(), "prompts")
+}
+
+// DefaultPath returns the path of the config file used when neither the
+// --config flag nor FIRST_AID_CONFIG is set.
+func DefaultPath() string {
+	return filepath.Join(Dir(), "config.json")
+}
+
+// Load builds the config from the config file, FIRST_AID_* environment
+// variables, and the flags in args. It returns the arguments remaining after
+// the flags.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("first-aid", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", "", "Path to the config file")
+	provider := fs.String("provider", "", "LLM provider (anthropic, openai or google)")
+	model := fs.String("model", "", "Model name")
+	betas := fs.String("betas", "", "Comma-separated list of provider betas")
+	thinkingBudget := fs.Int("thinking-budget", 0, "Thinking budget in tokens (0 disables thinking)")
+	apiKeyEnv := fs.String("api-key-env", "", "Environment variable holding the API key")
+	apiKeyFile := fs.String("api-key-file", "", "File holding the API key")
+	camera := fs.Bool("camera", false, "Enable the ONVIF camera tool")
+	chrome := fs.Bool("chrome", false, "Enable Chrome control")
+	approveAll := fs.Bool("yes", false, "Run tools without asking for approval (unless denied by the policy)")
+	addr := fs.String("addr", "", "Address for the API server (first-aid serve) to listen on")
+	budget := fs.Float64("budget", 0, "Maximum estimated cost of the session in USD (0 means no limit)")
+	promptProfile := fs.String("prompt", "", "Prompt profile to use (e.g. marvin or professional)")
+	jsonOutput := fs.Bool("json", false, "Print updates as JSON lines (implies non-interactive mode)")
+	record := fs.String("record", "", "Record the session to a fixture file")
+	replay := fs.String("replay", "", "Replay a recorded fixture file offline")
+	replayTools := fs.String("replay-tools", "", "Replay the tool results of a fixture file with the configured model")
+	resume := fs.String("resume", "", "Continue the session with this id (a unique prefix is enough)")
+	continueLatest := fs.Bool("continue", false, "Continue the latest session in this directory")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, fmt.Errorf("usage: first-aid [flags] [prompt]\n%s", flagUsage(fs))
+		}
+		return nil, nil, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("FIRST_AID_CONFIG")
+	}
+	explicitPath := path != ""
+	if !explicitPath {
+		path = DefaultPath()
+	}
+	c, err := ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicitPath {
+		c, err = &Config{}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.applyEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "provider":
+			c.Provider = *provider
+		case "model":
+			c.Model = *model
+		case "betas":
+			c.Betas = splitList(*betas)
+		case "thinking-budget":
+			c.ThinkingBudget = thinkingBudget
+		case "api-key-env":
+			c.APIKeyEnv = *apiKeyEnv
+		case "api-key-file":
+			c.APIKeyFile = *apiKeyFile
+		case "camera":
+			c.EnableOnvifCamera = *camera
+		case "chrome":
+			c.EnableChromeControl = *chrome
+		case "yes":
+			c.ApproveAll = *approveAll
+		case "addr":
+			c.ServeAddr = *addr
+		case "budget":
+			c.Budget.MaxUSD = *budget
+		case "prompt":
+			c.Prompt = *promptProfile
+		case "json":
+			c.JSONOutput = *jsonOutput
+		case "resume":
+			c.Resume = *resume
+		case "continue":
+			c.Continue = *continueLatest
+		case "record":
+			c.Record = *record
+		case "replay":
+			c.Replay = *replay
+		case "replay-tools":
+			c.ReplayTools = *replayTools
+		}
+	})
+
+	c.applyDefaults()
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// ReadFile reads a config file without applying environment variables or
+// defaults.
+func ReadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("FIRST_AID_PROVIDER"); v != "" {
+		c.Provider = v
+	}
+	if v := os.Getenv("FIRST_AID_MODEL"); v != "" {
+		c.Model = v
+	}
+	if v, ok := os.LookupEnv("FIRST_AID_BETAS"); ok {
+		c.Betas = splitList(v)
+	}
+	if v := os.Getenv("FIRST_AID_THINKING_BUDGET"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid FIRST_AID_THINKING_BUDGET: %w", err)
+		}
+		c.ThinkingBudget = &n
+	}
+	if v := os.Getenv("FIRST_AID_BUDGET"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid FIRST_AID_BUDGET: %w", err)
+		}
+		c.Budget.MaxUSD = f
+	}
+	if v := os.Getenv("FIRST_AID_PROMPT"); v != "" {
+		c.Prompt = v
+	}
+	if v := os.Getenv("FIRST_AID_SERVE_ADDR"); v != "" {
+		c.ServeAddr = v
+	}
+	if v := os.Getenv("FIRST_AID_SERVE_TOKEN"); v != "" {
+		c.ServeToken = v
+	}
+	if v := os.Getenv("FIRST_AID_API_KEY_ENV"); v != "" {
+		c.APIKeyEnv = v
+	}
+	if v := os.Getenv("FIRST_AID_API_KEY_FILE"); v != "" {
+		c.APIKeyFile = v
+	}
+	for name, dst := range map[string]*bool{
+		"FIRST_AID_ENABLE_ONVIF_CAMERA":   &c.EnableOnvifCamera,
+		"FIRST_AID_ENABLE_CHROME_CONTROL": &c.EnableChromeControl,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*dst = b
+	}
+	return nil
+}
+
+func (c *Config) applyDefaults() {
+	if c.Provider == "" {
+		c.Provider = ProviderAnthropic
+	}
+	c.Provider = strings.ToLower(c.Provider)
+	if c.Model == "" {
+		c.Model = DefaultModels[c.Provider]
+	}
+	if c.Betas == nil {
+		c.Betas = defaultBetas[c.Provider]
+	}
+	if c.DelegateTools == nil {
+		c.DelegateTools = defaultDelegateTools
+	}
+	if c.Prompt == "" {
+		c.Prompt = prompt.Default
+	}
+	if c.ThinkingBudget == nil {
+		n := defaultThinkingBudget
+		c.ThinkingBudget = &n
+	}
+	if c.APIKeyEnv == "" {
+		c.APIKeyEnv = defaultAPIKeyEnvs[c.Provider]
+	}
+	if c.MaxRetries == nil {
+		n := defaultMaxRetries
+		c.MaxRetries = &n
+	}
+	if c.CompactAfterTokens == nil {
+		n := defaultCompactAfter
+		c.CompactAfterTokens = &n
+	}
+	if c.ServeAddr == "" {
+		c.ServeAddr = defaultServeAddr
+	}
+	if c.Budget.Action == "" {
+		c.Budget.Action = usage.BudgetWarn
+	}
+	if c.ApprovalPolicy == "" {
+		c.ApprovalPolicy = filepath.Join(Dir(), "policy.json")
+	}
+	c.ApprovalPolicy = expandHome(c.ApprovalPolicy)
+	if c.AuditLog == "" {
+		c.AuditLog = filepath.Join(DataDir(), "audit.jsonl")
+	}
+	c.AuditLog = expandHome(c.AuditLog)
+	if c.RedactSecrets == nil {
+		redact := true
+		c.RedactSecrets = &redact
+	}
+	if c.Backups.MaxAgeDays == 0 {
+		c.Backups.MaxAgeDays = defaultBackupDays
+	}
+	if c.Backups.MaxSizeMB == 0 {
+		c.Backups.MaxSizeMB = defaultBackupMB
+	}
+}
+
+// WithModel returns a copy of the config that uses another model, and
+// optionally another provider. Provider specific settings that were left to
+// their defaults are reset to the new provider's defaults.
+func (c *Config) WithModel(provider, model string) (*Config, error) {
+	next := *c
+	if provider != "" && !strings.EqualFold(provider, c.Provider) {
+		next.Provider = provider
+		next.Model = ""
+		if slices.Equal(c.Betas, defaultBetas[c.Provider]) {
+			next.Betas = nil
+		}
+		if c.APIKeyEnv == defaultAPIKeyEnvs[c.Provider] {
+			next.APIKeyEnv = ""
+		}
+	}
+	if model != "" {
+		next.Model = model
+	}
+	next.applyDefaults()
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Price returns the price of the configured model, if it's known.
+func (c *Config) Price() (usage.Price, bool) {
+	return usage.DefaultPrices.Merge(c.Prices).Lookup(c.Provider, c.Model)
+}
+
+// Validate reports whether the config can be used to create a provider.
+func (c *Config) Validate() error {
+	if _, ok := DefaultModels[c.Provider]; !ok {
+		return fmt.Errorf("unsupported provider %q", c.Provider)
+	}
+	if c.ThinkingBudget != nil && *c.ThinkingBudget < 0 {
+		return fmt.Errorf("thinking budget must not be negative")
+	}
+	if c.MaxRetries != nil && *c.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+	for name, server := range c.MCPServers {
+		if server.Command == "" {
+			return fmt.Errorf("MCP server %q has no command", name)
+		}
+	}
+	for _, p := range c.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+	}
+	if c.CompactAfterTokens != nil && *c.CompactAfterTokens < 0 {
+		return fmt.Errorf("compactAfterTokens must not be negative")
+	}
+	if c.Resume != "" && c.Continue {
+		return fmt.Errorf("--resume and --continue can't be used together")
+	}
+	if c.Replay != "" && c.ReplayTools != "" {
+		return fmt.Errorf("--replay and --replay-tools can't be used together")
+	}
+	if c.Backups.MaxAgeDays < 0 || c.Backups.MaxSizeMB < 0 {
+		return fmt.Errorf("backup limits must not be negative")
+	}
+	if c.Budget.MaxUSD < 0 {
+		return fmt.Errorf("budget must not be negative")
+	}
+	if c.Budget.Action != "" && c.Budget.Action != usage.BudgetWarn && c.Budget.Action != usage.BudgetStop {
+		return fmt.Errorf("budget action must be %q or %q", usage.BudgetWarn, usage.BudgetStop)
+	}
+	return nil
+}
+
+// APIKey returns the API key from the configured file or environment
+// variable.
+func (c *Config) APIKey() (string, error) {
+	if c.APIKeyFile != "" {
+		data, err := os.ReadFile(expandHome(c.APIKeyFile))
+		if err != nil {
+			return "", fmt.Errorf("failed to read API key file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	key := os.Getenv(c.APIKeyEnv)
+	if key == "" {
+		return "", fmt.Errorf("missing API key: set %s", c.APIKeyEnv)
+	}
+	return key, nil
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		dirname, _ := os.UserHomeDir()
+		path = filepath.Join(dirname, path[2:])
+	}
+	return path
+}
+
+func flagUsage(fs *flag.FlagSet) string {
+	var sb strings.Builder
+	fs.SetOutput(&sb)
+	fs.PrintDefaults()
+	fs.SetOutput(io.Discard)
+	return sb.String()
+}
@@ -0,0 +1,180 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blixt/first-aid/config"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{}`))
+	c, args, err := config.Load([]string{"hello", "world"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Provider != config.ProviderAnthropic {
+		t.Errorf("expected provider %q, got %q", config.ProviderAnthropic, c.Provider)
+	}
+	if c.Model != config.DefaultModels[config.ProviderAnthropic] {
+		t.Errorf("unexpected model %q", c.Model)
+	}
+	if len(c.Betas) == 0 {
+		t.Errorf("expected default betas for anthropic")
+	}
+	if *c.ThinkingBudget != 1024 {
+		t.Errorf("expected thinking budget 1024, got %d", *c.ThinkingBudget)
+	}
+	if c.APIKeyEnv != "ANTHROPIC_API_KEY" {
+		t.Errorf("unexpected API key env %q", c.APIKeyEnv)
+	}
+	if c.Prompt != "marvin" {
+		t.Errorf("expected the marvin prompt profile, got %q", c.Prompt)
+	}
+	if !*c.RedactSecrets {
+		t.Errorf("expected secrets to be redacted")
+	}
+	if c.Backups.MaxAgeDays != 30 || c.Backups.MaxSizeMB != 500 {
+		t.Errorf("unexpected backup retention %+v", c.Backups)
+	}
+	if !slices.Equal(args, []string{"hello", "world"}) {
+		t.Errorf("unexpected args %q", args)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{"provider":"openai","model":"file-model","enableChromeControl":true}`))
+	t.Setenv("FIRST_AID_MODEL", "env-model")
+	t.Setenv("FIRST_AID_THINKING_BUDGET", "0")
+	t.Setenv("FIRST_AID_PROMPT", "env-prompt")
+
+	c, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Provider != config.ProviderOpenAI || c.Model != "env-model" {
+		t.Errorf("expected openai/env-model, got %s/%s", c.Provider, c.Model)
+	}
+	if !c.EnableChromeControl {
+		t.Errorf("expected chrome control to be enabled from file")
+	}
+	if len(c.Betas) != 0 {
+		t.Errorf("expected no betas for openai, got %q", c.Betas)
+	}
+	if c.APIKeyEnv != "OPENAI_API_KEY" {
+		t.Errorf("unexpected API key env %q", c.APIKeyEnv)
+	}
+	if c.Prompt != "env-prompt" {
+		t.Errorf("expected the prompt profile from env, got %q", c.Prompt)
+	}
+
+	c, args, err := config.Load([]string{"--model", "flag-model", "--betas", "", "--chrome=false", "--prompt", "professional", "hi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Model != "flag-model" {
+		t.Errorf("expected flag to override env, got %q", c.Model)
+	}
+	if c.Betas == nil || len(c.Betas) != 0 {
+		t.Errorf("expected explicitly empty betas, got %#v", c.Betas)
+	}
+	if c.EnableChromeControl {
+		t.Errorf("expected flag to disable chrome control")
+	}
+	if c.Prompt != "professional" {
+		t.Errorf("expected flag to override the prompt profile, got %q", c.Prompt)
+	}
+	if !slices.Equal(args, []string{"hi"}) {
+		t.Errorf("unexpected args %q", args)
+	}
+}
+
+func TestLoadResume(t *testing.T) {
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{}`))
+	c, args, err := config.Load([]string{"--resume", "20250708-1530", "why", "is", "it", "slow?"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Resume != "20250708-1530" || c.Continue || !slices.Equal(args, []string{"why", "is", "it", "slow?"}) {
+		t.Errorf("expected the session id to be the flag's value, got %q %v with args %q", c.Resume, c.Continue, args)
+	}
+
+	c, args, err = config.Load([]string{"--continue", "fixit", "now"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Resume != "" || !c.Continue || !slices.Equal(args, []string{"fixit", "now"}) {
+		t.Errorf("expected the prompt to be kept, got %q %v with args %q", c.Resume, c.Continue, args)
+	}
+
+	if _, _, err := config.Load([]string{"--resume"}); err == nil {
+		t.Error("expected an error for --resume without an id")
+	}
+	if _, _, err := config.Load([]string{"--resume", "20250708-1530", "--continue"}); err == nil {
+		t.Error("expected an error for both --resume and --continue")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{"provider":"skynet"}`))
+	if _, _, err := config.Load(nil); err == nil {
+		t.Fatal("expected error for unsupported provider")
+	}
+
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{"budget":{"maxUSD":1,"action":"panic"}}`))
+	if _, _, err := config.Load(nil); err == nil {
+		t.Fatal("expected error for unknown budget action")
+	}
+
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{"redactPatterns":["token-("]}`))
+	if _, _, err := config.Load(nil); err == nil {
+		t.Fatal("expected error for invalid redaction pattern")
+	}
+
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{"backups":{"maxAgeDays":-1}}`))
+	if _, _, err := config.Load(nil); err == nil {
+		t.Fatal("expected error for negative backup retention")
+	}
+
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{}`))
+	if _, _, err := config.Load([]string{"--replay", "a.jsonl", "--replay-tools", "b.jsonl"}); err == nil {
+		t.Fatal("expected error for both replay flags")
+	}
+
+	t.Setenv("FIRST_AID_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+	if _, _, err := config.Load(nil); err == nil {
+		t.Fatal("expected error for explicitly configured missing file")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Setenv("FIRST_AID_CONFIG", writeConfig(t, `{}`))
+	t.Setenv("MY_KEY", "secret")
+	c, _, err := config.Load([]string{"--api-key-env", "MY_KEY"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key, err := c.APIKey(); err != nil || key != "secret" {
+		t.Errorf("expected secret, got %q (%v)", key, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c.APIKeyFile = keyFile
+	if key, err := c.APIKey(); err != nil || key != "from-file" {
+		t.Errorf("expected from-file, got %q (%v)", key, err)
+	}
+}
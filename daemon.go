@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/prompt"
+	"github.com/blixt/first-aid/schedule"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/tts"
+)
+
+// daemonPollInterval is how often the daemon checks for due tasks. The file
+// is read again every time, so tasks scheduled by other first-aid processes
+// are picked up too.
+const daemonPollInterval = 30 * time.Second
+
+// jobs is the store of scheduled tasks, shared by the tools and the daemon.
+var jobs = sync.OnceValue(func() *schedule.Store {
+	return schedule.NewStore(filepath.Join(config.DataDir(), "schedule.json"))
+})
+
+// runDaemon runs scheduled tasks as they become due, until interrupted. Each
+// run is a new session, and its transcript is written to stdout and the
+// daemon log. There's no one to ask for approval, so tools that need it only
+// run if allowed by the policy or --yes.
+func runDaemon(cfg *config.Config, profile *prompt.Profile, model llms.Provider, store *session.Store, gate *approval.Gate) int {
+	logPath := filepath.Join(config.DataDir(), "daemon.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer logFile.Close()
+	out := io.MultiWriter(os.Stdout, logFile)
+
+	toolList, cleanup := loadTools(cfg, gate.Policy)
+	defer cleanup()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Running the tasks in %s (logging to %s)\n", jobs().Path(), logPath)
+	for {
+		due, err := jobs().Due(time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, job := range due {
+			if ctx.Err() != nil {
+				break
+			}
+			runJob(ctx, cfg, profile, model, toolList, gate, store, job, out)
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(daemonPollInterval):
+		}
+	}
+}
+
+// runJob runs a scheduled task as the first turn of a new session in the
+// task's directory, and schedules its next run.
+func runJob(ctx context.Context, cfg *config.Config, profile *prompt.Profile, model llms.Provider, toolList []tools.Tool, gate *approval.Gate, store *session.Store, job schedule.Job, out io.Writer) {
+	started := time.Now()
+	fmt.Fprintf(out, "=== %s: task %s in %s\n%s\n\n", started.Format(time.DateTime), job.ID, job.Cwd, job.Task)
+
+	finish := func(sessionID string, err error) {
+		if err != nil {
+			fmt.Fprintf(out, "Task %s failed: %s\n\n", job.ID, err)
+		} else {
+			fmt.Fprintf(out, "Task %s finished in %.0f seconds\n\n", job.ID, time.Since(started).Seconds())
+		}
+		if err := jobs().Finish(job.ID, started, time.Now(), sessionID, err); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	// Tasks run one at a time, so it's fine for them to change the directory
+	// of the whole process.
+	if err := os.Chdir(job.Cwd); err != nil {
+		finish("", err)
+		return
+	}
+	sess := session.New()
+	sess.SetTitle(fmt.Sprintf("Scheduled: %s", job.Task))
+	a := newApp(cfg, newAgent(cfg, profile, model, toolList), gate, store, sess)
+	a.status = func(status string) {
+		fmt.Fprintln(out, status)
+	}
+
+	var answer strings.Builder
+	endsWithNewline := true
+	for update := range a.chat(ctx, jobPrompt(job)) {
+		switch update := update.(type) {
+		case llms.TextUpdate:
+			if update.Text == "" {
+				continue
+			}
+			fmt.Fprint(out, update.Text)
+			answer.WriteString(update.Text)
+			endsWithNewline = strings.HasSuffix(update.Text, "\n")
+		case llms.ToolStartUpdate:
+			// Only the text after the last tool is the answer.
+			answer.Reset()
+		case llms.ToolDoneUpdate:
+			if !endsWithNewline {
+				fmt.Fprintln(out)
+				endsWithNewline = true
+			}
+			if err := update.Result.Error(); err != nil {
+				fmt.Fprintf(out, "❌ %s: %s\n", update.Result.Label(), firstaid.FirstLineString(err.Error()))
+			} else {
+				fmt.Fprintf(out, "✅ %s\n", update.Result.Label())
+			}
+		}
+	}
+	if !endsWithNewline {
+		fmt.Fprintln(out)
+	}
+	err := a.err()
+	finish(sess.ID, err)
+
+	if text := strings.TrimSpace(answer.String()); job.Speak && err == nil && text != "" {
+		if err := tts.Speak(text); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to speak the result of task %s: %v\n", job.ID, err)
+		}
+	}
+}
+
+// jobPrompt is the input of the turn that runs a scheduled task.
+func jobPrompt(job schedule.Job) string {
+	var sb strings.Builder
+	if job.Recurring() {
+		fmt.Fprintf(&sb, "This is a run of a task that the user scheduled to repeat on the cron schedule %q (task id %s).", job.Cron, job.ID)
+	} else {
+		fmt.Fprintf(&sb, "This is a task that the user scheduled for %s (task id %s).", job.Next.Local().Format(time.RFC1123), job.ID)
+	}
+	sb.WriteString(" The user isn’t watching, so don’t ask questions. Do the task and reply with the result.")
+	if job.Speak {
+		sb.WriteString(" Your reply will be read out loud, so keep it short and don’t use any formatting.")
+	}
+	fmt.Fprintf(&sb, "\n\n%s", job.Task)
+	return sb.String()
+}
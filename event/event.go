@@ -0,0 +1,90 @@
+// Package event converts the updates streamed by an LLM into plain values
+// suitable for machine-readable output such as JSON lines.
+package event
+
+import (
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/usage"
+)
+
+const (
+	TypeThinking   = "thinking"
+	TypeText       = "text"
+	TypeToolStart  = "tool_start"
+	TypeToolStatus = "tool_status"
+	TypeToolDone   = "tool_done"
+	TypeUsage      = "usage"
+	TypeError      = "error"
+	// TypeDone ends a stream of events for a turn, where the end isn't
+	// otherwise obvious (such as in a Server-Sent Events stream).
+	TypeDone = "done"
+)
+
+type Event struct {
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	ToolCallID string `json:"toolCallId,omitempty"`
+	Tool       string `json:"tool,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Images are the images returned by a tool, as data URIs.
+	Images []string `json:"images,omitempty"`
+
+	Usage *usage.Summary `json:"usage,omitempty"`
+}
+
+// FromUpdate converts an LLM update into an event. It returns false for
+// updates that have no event representation, such as tool argument deltas.
+func FromUpdate(update llms.Update) (Event, bool) {
+	switch update := update.(type) {
+	case llms.ThinkingUpdate:
+		return Event{Type: TypeThinking, Text: update.Text}, true
+	case llms.TextUpdate:
+		return Event{Type: TypeText, Text: update.Text}, true
+	case llms.ToolStartUpdate:
+		return Event{
+			Type:       TypeToolStart,
+			ToolCallID: update.ToolCallID,
+			Tool:       update.Tool.FuncName(),
+			Label:      update.Tool.Label(),
+		}, true
+	case llms.ToolStatusUpdate:
+		return Event{
+			Type:       TypeToolStatus,
+			ToolCallID: update.ToolCallID,
+			Tool:       update.Tool.FuncName(),
+			Status:     update.Status,
+		}, true
+	case llms.ToolDoneUpdate:
+		e := Event{
+			Type:       TypeToolDone,
+			ToolCallID: update.ToolCallID,
+			Tool:       update.Tool.FuncName(),
+			Label:      update.Result.Label(),
+		}
+		if err := update.Result.Error(); err != nil {
+			e.Error = err.Error()
+		}
+		for _, item := range update.Result.Content() {
+			if image, ok := item.(*content.ImageURL); ok {
+				e.Images = append(e.Images, image.URL)
+			}
+		}
+		return e, true
+	default:
+		return Event{}, false
+	}
+}
+
+// FromError creates an event for an error that ended the chat.
+func FromError(err error) Event {
+	return Event{Type: TypeError, Error: err.Error()}
+}
+
+// FromUsage creates an event for the token usage at the end of a turn.
+func FromUsage(summary usage.Summary) Event {
+	return Event{Type: TypeUsage, Usage: &summary}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+	"golang.org/x/term"
+
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/prompt"
+	"github.com/blixt/first-aid/pty"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/terminal"
+)
+
+// explainOutputBytes is how much of the end of a command's output is kept
+// for the diagnosis.
+const explainOutputBytes = 64 << 10
+
+// runExplain runs a command with its output shown live, and if it fails,
+// starts a conversation about why. It returns the exit code of the command.
+func runExplain(cfg *config.Config, profile *prompt.Profile, model llms.Provider, store *session.Store, gate *approval.Gate, args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	lines := fs.Int("lines", 50, "How many lines at the end of the output to give the model")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: first-aid explain [--lines N] -- <command> [args...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	command := shellCommand(fs.Args())
+
+	state, output, err := runInTerminal(command)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if state.Success() {
+		return 0
+	}
+	code := state.ExitCode()
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		if ws.Signal() == syscall.SIGINT {
+			// The user stopped it, so there's nothing to explain.
+			return 130
+		}
+		code = 128 + int(ws.Signal())
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return code
+	}
+	fmt.Printf("\n❌ %s failed (%s)\n\n", firstaid.FirstLineString(command), state)
+
+	sess := session.New()
+	sess.SetTitle(fmt.Sprintf("Explain: %s", command))
+	toolList, cleanup := loadTools(cfg, gate.Policy)
+	defer cleanup()
+	a := newApp(cfg, newAgent(cfg, profile, model, toolList), gate, store, sess)
+	input := explainPrompt(command, cwd, state.String(), terminal.CleanOutput(output, *lines), *lines)
+	if cfg.JSONOutput || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		runPipeTurn(a, input)
+	} else {
+		converse(a, input)
+	}
+	return code
+}
+
+// explainPrompt is the input of the turn that diagnoses a failed command.
+func explainPrompt(command, cwd, status, output string, lines int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "I ran this command in %q and it failed (%s):\n\n```\n%s\n```\n\n", cwd, status, command)
+	if output == "" {
+		sb.WriteString("It didn’t print anything.\n\n")
+	} else {
+		fmt.Fprintf(&sb, "These are the last lines it printed (up to %d):\n\n```\n%s\n```\n\n", lines, output)
+	}
+	sb.WriteString("Why did it fail, and how do I fix it? Investigate with your tools if the output isn’t enough to tell.")
+	return sb.String()
+}
+
+// runInTerminal runs the command in the shell with its output going to
+// stdout, and returns how it exited along with the end of its output. The
+// command gets a pseudo-terminal if possible, so that it behaves as if it
+// was run directly.
+func runInTerminal(command string) (*os.ProcessState, string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	tail := &tailBuffer{max: explainOutputBytes}
+
+	ptm, err := pty.Start(cmd)
+	if errors.Is(err, pty.ErrUnsupported) {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+		cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+		err = cmd.Run()
+		if cmd.ProcessState == nil {
+			return nil, "", err
+		}
+		return cmd.ProcessState, tail.String(), nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	defer ptm.Close()
+
+	// The command's terminal handles the input now, so the user's terminal
+	// passes it on as is.
+	stdin := int(os.Stdin.Fd())
+	if term.IsTerminal(stdin) {
+		if oldState, err := term.MakeRaw(stdin); err == nil {
+			defer term.Restore(stdin, oldState)
+		}
+		stopResizing := pty.InheritSize(ptm, os.Stdin)
+		defer stopResizing()
+		done := make(chan struct{})
+		defer close(done)
+		go pty.Forward(ptm, os.Stdin, done)
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		// Reading fails once the command and everything it started has
+		// exited.
+		io.Copy(io.MultiWriter(os.Stdout, tail), ptm)
+	}()
+	cmd.Wait()
+	// Don't wait long for background processes that keep the terminal open.
+	select {
+	case <-copied:
+	case <-time.After(time.Second):
+		ptm.Close()
+		<-copied
+	}
+	return cmd.ProcessState, tail.String(), nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+var reShellSafe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellCommand turns arguments into a shell command. A single argument is
+// used as is, so that `first-aid explain -- "make && ./app"` works.
+func shellCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if reShellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
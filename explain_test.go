@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"make && ./app"}, "make && ./app"},
+		{[]string{"go", "test", "./..."}, "go test ./..."},
+		{[]string{"grep", "-r", "it's here", "."}, `grep -r 'it'\''s here' .`},
+	}
+	for _, tt := range tests {
+		if got := shellCommand(tt.args); got != tt.want {
+			t.Errorf("shellCommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRunInTerminal(t *testing.T) {
+	state, output, err := runInTerminal(`printf 'building\r\n\033[31merror\033[0m: missing thing\n'; exit 3`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.ExitCode() != 3 {
+		t.Errorf("expected exit code 3, got %d", state.ExitCode())
+	}
+	if !strings.Contains(output, "missing thing") {
+		t.Errorf("expected the output to be captured, got %q", output)
+	}
+
+	state, _, err = runInTerminal("true")
+	if err != nil || !state.Success() {
+		t.Errorf("expected success, got %v, %v", state, err)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 5}
+	b.Write([]byte("abc"))
+	b.Write([]byte("defg"))
+	if got := b.String(); got != "cdefg" {
+		t.Errorf("expected the last 5 bytes, got %q", got)
+	}
+}
@@ -46,19 +46,19 @@ var LookAtRealWorld = tools.Func(
 			return tools.ErrorWithLabel("Look at real world", fmt.Errorf("failed to connect to camera: %v", err))
 		}
 
-		profile, err := getDefaultProfile(device)
+		profile, err := getDefaultProfile(r.Context(), device)
 		if err != nil {
 			return tools.ErrorWithLabel("Look at real world", fmt.Errorf("failed to get metadata about camera: %w", err))
 		}
 
 		if p.RelativePan != 0 || p.RelativeTilt != 0 {
-			err := relativeMove(device, profile.Token, p.RelativePan, p.RelativeTilt, 0)
+			err := relativeMove(r.Context(), device, profile.Token, p.RelativePan, p.RelativeTilt, 0)
 			if err != nil {
 				return tools.ErrorWithLabel("Look at real world", fmt.Errorf("failed to pan/tilt camera: %v", err))
 			}
 		}
 
-		photoPath, err := takePhoto()
+		photoPath, err := takePhoto(r.Context())
 		if err != nil {
 			return tools.ErrorWithLabel("Look at real world", fmt.Errorf("failed to get photo path: %v", err))
 		}
@@ -72,8 +72,8 @@ var LookAtRealWorld = tools.Func(
 	},
 )
 
-func getDefaultProfile(device *onvif.Device) (xsdonvif.Profile, error) {
-	res, err := sdkmedia.Call_GetProfiles(context.TODO(), device, media.GetProfiles{})
+func getDefaultProfile(ctx context.Context, device *onvif.Device) (xsdonvif.Profile, error) {
+	res, err := sdkmedia.Call_GetProfiles(ctx, device, media.GetProfiles{})
 	if err != nil {
 		return xsdonvif.Profile{}, err
 	}
@@ -83,7 +83,7 @@ func getDefaultProfile(device *onvif.Device) (xsdonvif.Profile, error) {
 	return res.Profiles[0], nil
 }
 
-func relativeMove(device *onvif.Device, token xsdonvif.ReferenceToken, pan, tilt, zoom float64) error {
+func relativeMove(ctx context.Context, device *onvif.Device, token xsdonvif.ReferenceToken, pan, tilt, zoom float64) error {
 	req := ptz.RelativeMove{
 		ProfileToken: token,
 		Translation: xsdonvif.PTZVector{
@@ -98,13 +98,17 @@ func relativeMove(device *onvif.Device, token xsdonvif.ReferenceToken, pan, tilt
 			},
 		},
 	}
-	if _, err := sdkptz.Call_RelativeMove(context.TODO(), device, req); err != nil {
+	if _, err := sdkptz.Call_RelativeMove(ctx, device, req); err != nil {
 		return err
 	}
 	// Wait up to 10 seconds for the pan/tilt to complete.
 	beganWaiting := time.Now()
 	for time.Since(beganWaiting) < 10*time.Second {
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
 		res, err := device.CallMethod(ptz.GetStatus{ProfileToken: token})
 		if err != nil {
 			return err
@@ -124,7 +128,7 @@ func relativeMove(device *onvif.Device, token xsdonvif.ReferenceToken, pan, tilt
 	return nil
 }
 
-func takePhoto() (string, error) {
+func takePhoto(ctx context.Context) (string, error) {
 	// Build the RTSP URI with username and password included.
 	u, err := url.Parse(os.Getenv("CAMERA_RTSP"))
 	if err != nil {
@@ -134,7 +138,7 @@ func takePhoto() (string, error) {
 	// Create a temporary path to write the snapshot to.
 	photoPath := fmt.Sprintf("%s/snapshot_%d.jpg", os.TempDir(), time.Now().Unix())
 	// Use ffmepg to read one frame from the RTSP stream.
-	cmd := exec.Command("ffmpeg", "-loglevel", "error", "-i", u.String(), "-f", "image2", "-vframes", "1", "-pix_fmt", "yuvj420p", photoPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-loglevel", "error", "-i", u.String(), "-f", "image2", "-vframes", "1", "-pix_fmt", "yuvj420p", photoPath)
 	if err := cmd.Run(); err != nil {
 		return "", err
 	}
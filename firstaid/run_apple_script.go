@@ -25,7 +25,7 @@ var RunAppleScript = tools.Func(
 		for _, line := range p.ScriptLines {
 			args = append(args, "-e", line)
 		}
-		cmd := exec.Command("osascript", args...)
+		cmd := exec.CommandContext(r.Context(), "osascript", args...)
 		output, err := cmd.CombinedOutput() // Combines both STDOUT and STDERR
 		if err != nil {
 			return tools.ErrorWithLabel(FirstLine(p.ScriptLines), fmt.Errorf("%w: %s", err, output))
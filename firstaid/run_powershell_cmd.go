@@ -17,7 +17,7 @@ var RunPowerShellCmd = tools.Func(
 	"run_powershell_cmd",
 	func(r tools.Runner, p RunPowerShellCmdParams) tools.Result {
 		// Run the PowerShell command and capture the output or error.
-		cmd := exec.Command("powershell", "-Command", p.Command)
+		cmd := exec.CommandContext(r.Context(), "powershell", "-Command", p.Command)
 		output, err := cmd.CombinedOutput() // Combines both STDOUT and STDERR
 		if err != nil {
 			return tools.ErrorWithLabel(p.Command, fmt.Errorf("%w: %s", err, output))
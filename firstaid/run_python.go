@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/flitsinc/go-llms/tools"
 )
@@ -54,7 +55,8 @@ var RunPython = tools.Func(
 		if pythonExecutable == "" {
 			return tools.ErrorWithLabel("Run Python failed", errors.New("could not find Python executable"))
 		}
-		cmd := exec.Command(pythonExecutable)
+		cmd := exec.CommandContext(r.Context(), pythonExecutable)
+		cmd.WaitDelay = time.Second
 		statementsJSON, err := json.Marshal(p.Statements)
 		if err != nil {
 			return tools.ErrorWithLabel("Run Python failed", err)
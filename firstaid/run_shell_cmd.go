@@ -28,6 +28,9 @@ var RunShellCmd = tools.Func(
 		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(p.DeadlineSeconds)*time.Second)
 		defer cancel()
 		cmd := exec.CommandContext(ctx, "sh", "-c", p.Command)
+		// Don't wait forever for subprocesses that keep the output open after
+		// the shell itself was killed.
+		cmd.WaitDelay = time.Second
 		output, err := cmd.CombinedOutput() // Combines both STDOUT and STDERR
 		if err != nil {
 			return tools.ErrorWithLabel(p.Command, fmt.Errorf("%w: %s", err, output))
@@ -0,0 +1,282 @@
+package firstaid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// ScratchpadFile is the file in the current directory where the todo list
+// and notes for that directory are kept.
+const ScratchpadFile = ".first-aid"
+
+const (
+	TodoOpen       = "open"
+	TodoInProgress = "in_progress"
+	TodoDone       = "done"
+	TodoCancelled  = "cancelled"
+)
+
+var todoStatuses = []string{TodoOpen, TodoInProgress, TodoDone, TodoCancelled}
+
+type TodoItem struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Notes   string    `json:"notes,omitempty"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// IsOpen reports whether the item still needs work.
+func (t TodoItem) IsOpen() bool {
+	return t.Status == TodoOpen || t.Status == TodoInProgress
+}
+
+type Scratchpad struct {
+	// Notes holds free-form notes, such as the contents of a scratchpad file
+	// from before it had a structure.
+	Notes  string     `json:"notes,omitempty"`
+	NextID int        `json:"nextId"`
+	Todos  []TodoItem `json:"todos"`
+}
+
+// scratchpadMu serializes changes to the scratchpad file, since tools may run
+// in parallel.
+var scratchpadMu sync.Mutex
+
+// LoadScratchpad reads the scratchpad file. A missing file is an empty
+// scratchpad, and a file that isn't JSON is kept as notes.
+func LoadScratchpad(path string) (*Scratchpad, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Scratchpad{NextID: 1}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	s := &Scratchpad{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	} else {
+		s.Notes = string(data)
+	}
+	if s.NextID < 1 {
+		s.NextID = 1
+	}
+	for _, t := range s.Todos {
+		s.NextID = max(s.NextID, t.ID+1)
+	}
+	return s, nil
+}
+
+func (s *Scratchpad) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, bytes.NewReader(append(data, '\n')))
+}
+
+// Add adds an open todo item and returns it.
+func (s *Scratchpad) Add(title, notes string) TodoItem {
+	now := time.Now()
+	item := TodoItem{ID: s.NextID, Title: title, Notes: notes, Status: TodoOpen, Created: now, Updated: now}
+	s.NextID++
+	s.Todos = append(s.Todos, item)
+	return item
+}
+
+// Item returns a pointer to the todo item with the id, or nil.
+func (s *Scratchpad) Item(id int) *TodoItem {
+	for i := range s.Todos {
+		if s.Todos[i].ID == id {
+			return &s.Todos[i]
+		}
+	}
+	return nil
+}
+
+// OpenTodos returns the items that still need work.
+func (s *Scratchpad) OpenTodos() []TodoItem {
+	var open []TodoItem
+	for _, t := range s.Todos {
+		if t.IsOpen() {
+			open = append(open, t)
+		}
+	}
+	return open
+}
+
+// ScratchpadSummary describes the scratchpad in the current directory for the
+// system prompt, including all open todo items.
+func ScratchpadSummary() string {
+	s, err := LoadScratchpad(ScratchpadFile)
+	if err != nil {
+		return fmt.Sprintf("The %s file in the current directory could not be read: %s", ScratchpadFile, err)
+	}
+	open := s.OpenTodos()
+	if len(open) == 0 && s.Notes == "" {
+		return "There are no open todo items for the current directory."
+	}
+	var sb strings.Builder
+	if s.Notes != "" {
+		fmt.Fprintf(&sb, "There are notes for the current directory (%s), use scratchpad_read to see them.\n", line(countLines(s.Notes)))
+	}
+	if len(open) == 0 {
+		sb.WriteString("There are no open todo items for the current directory.")
+		return sb.String()
+	}
+	sb.WriteString("Open todo items for the current directory (pick these up where you left off):")
+	for _, t := range open {
+		fmt.Fprintf(&sb, "\n- #%d [%s] %s", t.ID, t.Status, t.Title)
+		if t.Notes != "" {
+			fmt.Fprintf(&sb, " (%s)", reWhitespace.ReplaceAllString(t.Notes, " "))
+		}
+	}
+	return sb.String()
+}
+
+func countLines(s string) int {
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		// This just means the last line ended with a newline, and we shouldn't
+		// the emptiness after the newline as another line.
+		return len(lines) - 1
+	}
+	return len(lines)
+}
+
+// updateScratchpad loads the scratchpad, applies fn and saves the result if
+// fn succeeded.
+func updateScratchpad(fn func(s *Scratchpad) error) error {
+	scratchpadMu.Lock()
+	defer scratchpadMu.Unlock()
+	s, err := LoadScratchpad(ScratchpadFile)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.Save(ScratchpadFile)
+}
+
+type ScratchpadReadParams struct{}
+
+var ScratchpadRead = tools.Func(
+	"Read scratchpad",
+	"Read the notes and all todo items (including finished ones) for the current directory.",
+	"scratchpad_read",
+	func(r tools.Runner, p ScratchpadReadParams) tools.Result {
+		scratchpadMu.Lock()
+		s, err := LoadScratchpad(ScratchpadFile)
+		scratchpadMu.Unlock()
+		if err != nil {
+			return tools.ErrorWithLabel("Read scratchpad", err)
+		}
+		return tools.SuccessWithLabel("Read scratchpad", s)
+	},
+)
+
+type TodoAddParams struct {
+	Title string `json:"title" description:"A short description of the work to do."`
+	Notes string `json:"notes,omitempty" description:"Details needed to pick up the work later."`
+}
+
+var TodoAdd = tools.Func(
+	"Add todo item",
+	"Add an item to the todo list for the current directory, to remember work that needs to be done now or in a later session.",
+	"todo_add",
+	func(r tools.Runner, p TodoAddParams) tools.Result {
+		if strings.TrimSpace(p.Title) == "" {
+			return tools.ErrorWithLabel("Add todo item", fmt.Errorf("the title must not be empty"))
+		}
+		var item TodoItem
+		err := updateScratchpad(func(s *Scratchpad) error {
+			item = s.Add(strings.TrimSpace(p.Title), strings.TrimSpace(p.Notes))
+			return nil
+		})
+		if err != nil {
+			return tools.ErrorWithLabel("Add todo item", err)
+		}
+		return tools.SuccessWithLabel(fmt.Sprintf("Added todo #%d: %s", item.ID, item.Title), item)
+	},
+)
+
+type TodoUpdateParams struct {
+	ID     int    `json:"id"`
+	Status string `json:"status,omitempty" description:"One of open, in_progress, done or cancelled."`
+	Title  string `json:"title,omitempty" description:"A new title, if it should change."`
+	Notes  string `json:"notes,omitempty" description:"New notes, replacing the old ones."`
+}
+
+var TodoUpdate = tools.Func(
+	"Update todo item",
+	"Change the status, title or notes of an item on the todo list for the current directory. Mark items done as soon as they are finished.",
+	"todo_update",
+	func(r tools.Runner, p TodoUpdateParams) tools.Result {
+		label := fmt.Sprintf("Update todo #%d", p.ID)
+		if p.Status != "" && !slices.Contains(todoStatuses, p.Status) {
+			return tools.ErrorWithLabel(label, fmt.Errorf("invalid status %q (must be one of %s)", p.Status, strings.Join(todoStatuses, ", ")))
+		}
+		var item TodoItem
+		err := updateScratchpad(func(s *Scratchpad) error {
+			t := s.Item(p.ID)
+			if t == nil {
+				return fmt.Errorf("there is no todo item with id %d", p.ID)
+			}
+			if p.Status != "" {
+				t.Status = p.Status
+			}
+			if title := strings.TrimSpace(p.Title); title != "" {
+				t.Title = title
+			}
+			if p.Notes != "" {
+				t.Notes = strings.TrimSpace(p.Notes)
+			}
+			t.Updated = time.Now()
+			item = *t
+			return nil
+		})
+		if err != nil {
+			return tools.ErrorWithLabel(label, err)
+		}
+		return tools.SuccessWithLabel(fmt.Sprintf("Todo #%d is %s: %s", item.ID, strings.ReplaceAll(item.Status, "_", " "), item.Title), item)
+	},
+)
+
+type TodoListParams struct {
+	All bool `json:"all,omitempty" description:"Include finished and cancelled items."`
+}
+
+var TodoList = tools.Func(
+	"List todo items",
+	"List the open items on the todo list for the current directory.",
+	"todo_list",
+	func(r tools.Runner, p TodoListParams) tools.Result {
+		scratchpadMu.Lock()
+		s, err := LoadScratchpad(ScratchpadFile)
+		scratchpadMu.Unlock()
+		if err != nil {
+			return tools.ErrorWithLabel("List todo items", err)
+		}
+		items := s.OpenTodos()
+		if p.All {
+			items = s.Todos
+		}
+		if items == nil {
+			items = []TodoItem{}
+		}
+		return tools.SuccessWithLabel(fmt.Sprintf("List todo items (%d)", len(items)), map[string]any{"todos": items})
+	},
+)
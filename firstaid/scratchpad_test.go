@@ -0,0 +1,61 @@
+package firstaid
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/flitsinc/go-llms/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoTools(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile(ScratchpadFile, []byte("remember the milk\n"), 0644))
+
+	result := TodoAdd.Run(tools.NopRunner, json.RawMessage(`{"title":"Fix the printer","notes":"It jams on page 2"}`))
+	require.NoError(t, result.Error())
+	result = TodoAdd.Run(tools.NopRunner, json.RawMessage(`{"title":"Update drivers"}`))
+	require.NoError(t, result.Error())
+	result = TodoAdd.Run(tools.NopRunner, json.RawMessage(`{"title":"  "}`))
+	require.Error(t, result.Error())
+
+	result = TodoUpdate.Run(tools.NopRunner, json.RawMessage(`{"id":1,"status":"done"}`))
+	require.NoError(t, result.Error())
+	assert.Equal(t, "Todo #1 is done: Fix the printer", result.Label())
+	result = TodoUpdate.Run(tools.NopRunner, json.RawMessage(`{"id":2,"status":"finished"}`))
+	require.Error(t, result.Error())
+	result = TodoUpdate.Run(tools.NopRunner, json.RawMessage(`{"id":3,"status":"done"}`))
+	require.Error(t, result.Error())
+
+	var listed struct {
+		Todos []TodoItem `json:"todos"`
+	}
+	result = TodoList.Run(tools.NopRunner, json.RawMessage(`{}`))
+	require.NoError(t, result.Error())
+	require.NoError(t, json.Unmarshal(extractJSONFromResult(t, result), &listed))
+	require.Len(t, listed.Todos, 1)
+	assert.Equal(t, 2, listed.Todos[0].ID)
+	assert.Equal(t, TodoOpen, listed.Todos[0].Status)
+
+	s, err := LoadScratchpad(ScratchpadFile)
+	require.NoError(t, err)
+	assert.Equal(t, "remember the milk\n", s.Notes, "notes from an unstructured file should be kept")
+	assert.Equal(t, 3, s.NextID)
+	require.Len(t, s.Todos, 2)
+	assert.False(t, s.Todos[0].Updated.Before(s.Todos[0].Created))
+
+	summary := ScratchpadSummary()
+	assert.Contains(t, summary, "#2 [open] Update drivers")
+	assert.NotContains(t, summary, "Fix the printer")
+	assert.Contains(t, summary, "notes for the current directory (1 line)")
+}
+
+func TestSpliceFileRefusesScratchpad(t *testing.T) {
+	t.Chdir(t.TempDir())
+	result := SpliceFile.Run(tools.NopRunner, json.RawMessage(`{"path":".first-aid","start":0,"insertLines":["{"]}`))
+	require.Error(t, result.Error())
+	_, err := os.Stat(ScratchpadFile)
+	assert.True(t, os.IsNotExist(err))
+}
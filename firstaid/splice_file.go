@@ -8,7 +8,6 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/flitsinc/go-llms/tools"
 )
@@ -27,6 +26,9 @@ var SpliceFile = tools.Func(
 	func(r tools.Runner, p SpliceFileParams) tools.Result {
 		r.Report(fmt.Sprintf("Updating file (%s)", path.Base(p.Path)))
 		p.Path = expandPath(p.Path)
+		if filepath.Base(p.Path) == ScratchpadFile {
+			return tools.ErrorWithLabel(p.Path, fmt.Errorf("%s is managed by the todo tools, use those instead", ScratchpadFile))
+		}
 		// Open or create the file if it doesn't exist.
 		file, err := os.OpenFile(p.Path, os.O_RDWR|os.O_CREATE, 0644)
 		if err != nil {
@@ -65,14 +67,6 @@ var SpliceFile = tools.Func(
 			i++
 		}
 
-		// Create a backup of the original file (if it wasn't empty).
-		if i > 0 {
-			backupPath := fmt.Sprintf("%s.%d.bak", p.Path, time.Now().Unix())
-			if err := copyFile(p.Path, backupPath); err != nil {
-				return tools.ErrorWithLabel(p.Path, fmt.Errorf("failed to create backup: %w", err))
-			}
-		}
-
 		if err := writeFileAtomically(p.Path, strings.NewReader(result.String())); err != nil {
 			return tools.ErrorWithLabel(p.Path, fmt.Errorf("failed to write updated content: %w", err))
 		}
@@ -103,16 +97,6 @@ var SpliceFile = tools.Func(
 		})
 	})
 
-func copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	return writeFileAtomically(dst, srcFile)
-}
-
 func writeFileAtomically(dst string, content io.Reader) error {
 	tmpDstFile, err := os.CreateTemp(filepath.Dir(dst), "tmp-")
 	if err != nil {
@@ -25,10 +25,10 @@ var TakeScreenshot = tools.Func(
 		var cmd *exec.Cmd
 		if runtime.GOOS == "windows" {
 			// PowerShell command to take a screenshot on Windows.
-			cmd = exec.Command("powershell", "-command", fmt.Sprintf("Add-Type -AssemblyName System.Windows.Forms; $bmp = New-Object System.Drawing.Bitmap([System.Windows.Forms.SystemInformation]::VirtualScreen.Width, [System.Windows.Forms.SystemInformation]::VirtualScreen.Height); $graph = [System.Drawing.Graphics]::FromImage($bmp); $graph.CopyFromScreen([System.Windows.Forms.SystemInformation]::VirtualScreen.Location, [System.Drawing.Point]::Empty, $bmp.Size); $bmp.Save('%s');", screenshotPath))
+			cmd = exec.CommandContext(r.Context(), "powershell", "-command", fmt.Sprintf("Add-Type -AssemblyName System.Windows.Forms; $bmp = New-Object System.Drawing.Bitmap([System.Windows.Forms.SystemInformation]::VirtualScreen.Width, [System.Windows.Forms.SystemInformation]::VirtualScreen.Height); $graph = [System.Drawing.Graphics]::FromImage($bmp); $graph.CopyFromScreen([System.Windows.Forms.SystemInformation]::VirtualScreen.Location, [System.Drawing.Point]::Empty, $bmp.Size); $bmp.Save('%s');", screenshotPath))
 		} else if runtime.GOOS == "darwin" {
 			// Command for macOS to take a screenshot.
-			cmd = exec.Command("screencapture", "-x", screenshotPath)
+			cmd = exec.CommandContext(r.Context(), "screencapture", "-x", screenshotPath)
 		} else {
 			return tools.ErrorWithLabel("Take screenshot", fmt.Errorf("unsupported platform %s", runtime.GOOS))
 		}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/recording"
+)
+
+// loadReplay loads the fixture to replay with --replay or --replay-tools, or
+// returns nil if neither was used.
+func loadReplay(cfg *config.Config) (*recording.Recording, error) {
+	path := cmp.Or(cfg.Replay, cfg.ReplayTools)
+	if path == "" {
+		return nil, nil
+	}
+	return recording.Load(path)
+}
+
+// record makes the app record its session to a fixture file. Call the
+// returned function when the session is over.
+func (a *app) record(path string) (func(), error) {
+	recorder, err := recording.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	// Added last, so that they see what the model and the tools really did
+	// (after retries and approval).
+	a.ai.UseProvider(recorder.Provider)
+	a.ai.Use(recorder.Tool)
+	a.recorder = recorder
+	return func() {
+		if err := recorder.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}, nil
+}
+
+// runReplay runs the turns of a recorded session, or the prompt in args if
+// any, with the tool results taken from the recording. It returns the exit
+// code of the last turn that failed.
+func runReplay(a *app, replay *recording.Recording, args []string) int {
+	a.ai.Use(replay.Tool)
+	inputs := replay.Inputs()
+	if len(args) > 0 {
+		input, err := readPipeInput(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitProviderError
+		}
+		inputs = []string{input}
+	}
+	if len(inputs) == 0 {
+		fmt.Fprintln(os.Stderr, "The recording has no turns to replay.")
+		return exitProviderError
+	}
+	code := 0
+	for i, input := range inputs {
+		if !a.cfg.JSONOutput {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("> %s\n\n", input)
+		}
+		code = cmp.Or(runPipeTurn(a, input), code)
+	}
+	return code
+}
@@ -0,0 +1,101 @@
+// Package jsonl reads and writes files of JSON lines that several processes
+// append to, such as the audit log, the backup index and the terminal log.
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Append adds v to the file at path as a line, creating the file and its
+// directory if they don't exist.
+func Append(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// A single write, so that lines from different processes don't
+	// interleave.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read calls fn with each line of the file at path, oldest first, and
+// returns the number of lines that were skipped because they're broken, e.g.
+// by a write that was cut short or that raced with Write. A file that doesn't
+// exist is empty.
+func Read[T any](path string, fn func(T)) (skipped int, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var v T
+			if json.Unmarshal(line, &v) == nil {
+				fn(v)
+			} else {
+				skipped++
+			}
+		}
+		if err == io.EOF {
+			return skipped, nil
+		} else if err != nil {
+			return skipped, err
+		}
+	}
+}
+
+// ReadAll returns the lines of the file at path, oldest first, skipping the
+// broken ones (see Read).
+func ReadAll[T any](path string) ([]T, error) {
+	var all []T
+	_, err := Read(path, func(v T) { all = append(all, v) })
+	return all, err
+}
+
+// Write replaces the file at path with the lines in vs. The file is replaced
+// atomically, but lines that another process appends while it's being
+// written are lost.
+func Write[T any](path string, vs []T) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, v := range vs {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,56 @@
+package jsonl_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blixt/first-aid/jsonl"
+)
+
+type item struct {
+	N int `json:"n"`
+}
+
+func TestReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "items.jsonl")
+	if items, err := jsonl.ReadAll[item](path); err != nil || items != nil {
+		t.Fatalf("expected a missing file to be empty, got %v: %v", items, err)
+	}
+	for n := range 3 {
+		if err := jsonl.Append(path, item{n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write that was cut short, followed by a blank line.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"n": ` + "\n\n")
+	file.Close()
+	if err := jsonl.Append(path, item{3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []item
+	skipped, err := jsonl.Read(path, func(i item) { items = append(items, i) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []item{{0}, {1}, {2}, {3}}; !slices.Equal(items, want) || skipped != 1 {
+		t.Errorf("expected %v with 1 line skipped, got %v with %d", want, items, skipped)
+	}
+
+	if err := jsonl.Write(path, items[2:]); err != nil {
+		t.Fatal(err)
+	}
+	items, err = jsonl.ReadAll[item](path)
+	if want := []item{{2}, {3}}; err != nil || !slices.Equal(items, want) {
+		t.Errorf("expected %v, got %v: %v", want, items, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the file to be left, got %v", entries)
+	}
+}
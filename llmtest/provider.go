@@ -0,0 +1,292 @@
+// Package llmtest provides a fake LLM provider that replays scripted
+// responses, so that code driving an LLM can be tested without a real model.
+//
+// A script is a list of responses, one for every request the LLM makes. A turn
+// where the model calls a tool takes two responses: one with the tool call,
+// and one answering the tool result:
+//
+//	provider := llmtest.NewProvider(t,
+//		llmtest.Response{
+//			llmtest.Thinking("Let's look around."),
+//			llmtest.ToolCall("list_files", `{"path": "."}`),
+//		},
+//		llmtest.Response{
+//			llmtest.ExpectToolResult("list_files", "main.go"),
+//			llmtest.Text("There's a main.go file."),
+//		},
+//	)
+package llmtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+type stepKind int
+
+const (
+	stepThinking stepKind = iota
+	stepText
+	stepToolCall
+	stepError
+	stepExpectToolResult
+	stepUsage
+)
+
+// Step is one part of a scripted response.
+type Step struct {
+	kind     stepKind
+	text     string
+	name     string
+	id       string
+	args     json.RawMessage
+	err      error
+	contains string
+	usage    llms.Usage
+}
+
+// Thinking streams a thought.
+func Thinking(text string) Step {
+	return Step{kind: stepThinking, text: text}
+}
+
+// Text streams text.
+func Text(text string) Step {
+	return Step{kind: stepText, text: text}
+}
+
+// ToolCall streams a call to the named tool with the JSON arguments.
+func ToolCall(name, args string) Step {
+	return Step{kind: stepToolCall, name: name, args: json.RawMessage(args)}
+}
+
+// Error ends the response with an error, as if the provider failed.
+func Error(err error) Step {
+	return Step{kind: stepError, err: err}
+}
+
+// ExpectToolResult checks that the request being answered contains a result
+// for every call to the named tool in the previous response, and that each
+// result contains the given text. It fails the test otherwise.
+func ExpectToolResult(name, contains string) Step {
+	return Step{kind: stepExpectToolResult, name: name, contains: contains}
+}
+
+// Usage sets the number of tokens the response reports using.
+func Usage(input, output int) Step {
+	return Step{kind: stepUsage, usage: llms.Usage{InputTokens: input, OutputTokens: output}}
+}
+
+// Response is the scripted answer to one request.
+type Response []Step
+
+// Request is a request that the provider received.
+type Request struct {
+	SystemPrompt content.Content
+	Messages     []llms.Message
+}
+
+// Provider replays a script of responses. It fails the test if it gets more
+// requests than there are responses, or if the test ends before all of them
+// were used.
+type Provider struct {
+	t         testing.TB
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+	nextID    int
+}
+
+var _ llms.Provider = (*Provider)(nil)
+
+func NewProvider(t testing.TB, responses ...Response) *Provider {
+	p := &Provider{t: t, responses: responses}
+	t.Cleanup(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if n := len(p.responses) - len(p.requests); n > 0 {
+			t.Errorf("llmtest: %d of %d scripted responses were not used", n, len(p.responses))
+		}
+	})
+	return p
+}
+
+func (p *Provider) Company() string {
+	return "Fake"
+}
+
+func (p *Provider) Model() string {
+	return "fake"
+}
+
+// Requests returns the requests received so far.
+func (p *Provider) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.requests)
+}
+
+func (p *Provider) Generate(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) llms.ProviderStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := len(p.requests)
+	p.requests = append(p.requests, Request{SystemPrompt: systemPrompt, Messages: slices.Clone(messages)})
+	if i >= len(p.responses) {
+		p.t.Errorf("llmtest: got request %d, but only %d responses were scripted", i+1, len(p.responses))
+		return &stream{ctx: ctx, err: errors.New("llmtest: no more scripted responses")}
+	}
+
+	s := &stream{ctx: ctx}
+	for _, step := range p.responses[i] {
+		switch step.kind {
+		case stepExpectToolResult:
+			p.checkToolResults(i, messages, step)
+		case stepToolCall:
+			p.nextID++
+			step.id = fmt.Sprintf("call_%d", p.nextID)
+			s.steps = append(s.steps, step)
+		case stepUsage:
+			s.usage = step.usage
+		default:
+			s.steps = append(s.steps, step)
+		}
+	}
+	return s
+}
+
+func (p *Provider) checkToolResults(i int, messages []llms.Message, step Step) {
+	p.t.Helper()
+	var calls []llms.ToolCall
+	for j := len(messages) - 1; j >= 0; j-- {
+		if len(messages[j].ToolCalls) > 0 {
+			calls = messages[j].ToolCalls
+			break
+		}
+	}
+	found := false
+	for _, call := range calls {
+		if call.Name != step.name {
+			continue
+		}
+		found = true
+		j := slices.IndexFunc(messages, func(m llms.Message) bool { return m.ToolCallID == call.ID })
+		if j < 0 {
+			p.t.Errorf("llmtest: response %d: request has no result for the %s call %s", i+1, call.Name, call.ID)
+			continue
+		}
+		if text := ContentText(messages[j].Content); !strings.Contains(text, step.contains) {
+			p.t.Errorf("llmtest: response %d: expected the result of %s to contain %q, got %q", i+1, call.Name, step.contains, text)
+		}
+	}
+	if !found {
+		p.t.Errorf("llmtest: response %d: expected a result for %s, but it wasn't called", i+1, step.name)
+	}
+}
+
+// ContentText returns the text and JSON in c as a string.
+func ContentText(c content.Content) string {
+	var parts []string
+	for _, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			parts = append(parts, item.Text)
+		case *content.JSON:
+			parts = append(parts, string(item.Data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// stream streams the steps of a response, one status per step, except for
+// tool calls which begin, get their arguments and become ready in turn.
+type stream struct {
+	ctx   context.Context
+	steps []Step
+	err   error
+	usage llms.Usage
+
+	text     string
+	thought  content.Thought
+	toolCall llms.ToolCall
+	message  llms.Message
+}
+
+func (s *stream) Err() error {
+	return s.err
+}
+
+func (s *stream) Iter() iter.Seq[llms.StreamStatus] {
+	return func(yield func(llms.StreamStatus) bool) {
+		if s.err != nil {
+			return
+		}
+		s.message = llms.Message{Role: "assistant"}
+		for _, step := range s.steps {
+			if err := s.ctx.Err(); err != nil {
+				s.err = err
+				return
+			}
+			switch step.kind {
+			case stepThinking:
+				s.thought = content.Thought{ID: "thought", Text: step.text}
+				s.message.Content = append(s.message.Content, &content.Thought{ID: "thought", Text: step.text})
+				if !yield(llms.StreamStatusThinking) {
+					return
+				}
+			case stepText:
+				s.text = step.text
+				s.message.Content = append(s.message.Content, &content.Text{Text: step.text})
+				if !yield(llms.StreamStatusText) {
+					return
+				}
+			case stepToolCall:
+				s.toolCall = llms.ToolCall{ID: step.id, Name: step.name}
+				if !yield(llms.StreamStatusToolCallBegin) {
+					return
+				}
+				s.toolCall.Arguments = step.args
+				if !yield(llms.StreamStatusToolCallDelta) {
+					return
+				}
+				s.message.ToolCalls = append(s.message.ToolCalls, s.toolCall)
+				if !yield(llms.StreamStatusToolCallReady) {
+					return
+				}
+			case stepError:
+				s.err = step.err
+				return
+			}
+		}
+	}
+}
+
+func (s *stream) Message() llms.Message {
+	return s.message
+}
+
+func (s *stream) Text() string {
+	return s.text
+}
+
+func (s *stream) ToolCall() llms.ToolCall {
+	return s.toolCall
+}
+
+func (s *stream) Thought() content.Thought {
+	return s.thought
+}
+
+func (s *stream) Usage() llms.Usage {
+	return s.usage
+}
@@ -0,0 +1,62 @@
+package llmtest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/llmtest"
+)
+
+func TestProviderStream(t *testing.T) {
+	p := llmtest.NewProvider(t,
+		llmtest.Response{
+			llmtest.Thinking("hmm"),
+			llmtest.Text("Hi"),
+			llmtest.ToolCall("echo", `{"text": "a"}`),
+			llmtest.Usage(10, 5),
+		},
+		llmtest.Response{
+			llmtest.Error(errors.New("boom")),
+		},
+	)
+
+	s := p.Generate(context.Background(), nil, nil, nil, nil)
+	var statuses []llms.StreamStatus
+	for status := range s.Iter() {
+		statuses = append(statuses, status)
+	}
+	want := []llms.StreamStatus{
+		llms.StreamStatusThinking,
+		llms.StreamStatusText,
+		llms.StreamStatusToolCallBegin,
+		llms.StreamStatusToolCallDelta,
+		llms.StreamStatusToolCallReady,
+	}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("expected statuses %v, got %v", want, statuses)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	msg := s.Message()
+	if msg.Role != "assistant" || len(msg.Content) != 2 || len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Name != "echo" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if u := s.Usage(); u.InputTokens != 10 || u.OutputTokens != 5 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+
+	s = p.Generate(context.Background(), nil, []llms.Message{msg}, nil, nil)
+	for range s.Iter() {
+	}
+	if err := s.Err(); err == nil || err.Error() != "boom" {
+		t.Errorf("expected the scripted error, got %v", err)
+	}
+	if n := len(p.Requests()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
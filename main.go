@@ -1,141 +1,274 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
-	"unicode"
 
-	"github.com/flitsinc/go-llms/anthropic"
 	"github.com/flitsinc/go-llms/content"
 	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
 	"github.com/joho/godotenv"
 	"github.com/peterh/liner"
+	"golang.org/x/term"
 
+	"github.com/blixt/first-aid/agent"
+	"github.com/blixt/first-aid/approval"
 	"github.com/blixt/first-aid/chromecontrol"
+	"github.com/blixt/first-aid/config"
 	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/project"
+	"github.com/blixt/first-aid/prompt"
 	"github.com/blixt/first-aid/writer"
 )
 
-const (
-	EnableOnvifCamera   = false
-	EnableChromeControl = false
-)
-
 func main() {
 	// Load .env if it exists. TODO: This should probably change to .Load().
 	godotenv.Overload()
 
-	// model := openai.New(os.Getenv("OPENAI_API_KEY"), "gpt-4o")
-	// model := google.New("gemini-1.5-pro-001").WithGeminiAPI(os.Getenv("GOOGLE_API_KEY"))
-	model := anthropic.New(os.Getenv("ANTHROPIC_API_KEY"), "claude-sonnet-4-20250514").
-		WithBeta("interleaved-thinking-2025-05-14").
-		WithBeta("fine-grained-tool-streaming-2025-05-14").
-		WithThinking(1024)
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	ai := llms.New(
-		model,
-		firstaid.ListFiles,
-		firstaid.LookAtImage,
-		firstaid.RunPython,
-		firstaid.SliceFile,
-		firstaid.SpliceFile,
-		firstaid.SpeakOutLoud,
-	)
+	// The MCP server only runs tools, so it doesn't need a provider.
+	if len(args) == 1 && args[0] == "mcp-serve" {
+		os.Exit(runMCPServer(cfg))
+	}
+	// Neither do the session list, the audit log, the backups and the shell
+	// hooks.
+	if len(args) == 1 && args[0] == "sessions" {
+		os.Exit(listSessions(sessionStore()))
+	}
+	if len(args) > 0 && args[0] == "audit" {
+		os.Exit(runAudit(cfg, args[1:]))
+	}
+	if len(args) > 0 && args[0] == "backups" {
+		os.Exit(runBackups(cfg, args[1:]))
+	}
+	if len(args) > 0 && args[0] == "shell-init" {
+		os.Exit(runShellInit(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "shell-record" {
+		os.Exit(runShellRecord(args[1:]))
+	}
+
+	replay, err := loadReplay(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var model llms.Provider
+	if cfg.Replay != "" {
+		model = replay.Provider()
+	} else if model, err = newProvider(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	store := sessionStore()
+
+	policy, err := approval.LoadPolicy(cfg.ApprovalPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	gate := approval.NewGate(policy)
+	gate.ApproveAll = cfg.ApproveAll
+
+	profile, err := prompt.Load(cfg.Prompt, config.PromptsDir())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(args) == 1 && args[0] == "serve" {
+		os.Exit(runServer(cfg, profile, model, store, gate))
+	}
+	if len(args) == 1 && args[0] == "daemon" {
+		os.Exit(runDaemon(cfg, profile, model, store, gate))
+	}
+	if len(args) > 0 && args[0] == "explain" {
+		os.Exit(runExplain(cfg, profile, model, store, gate, args[1:]))
+	}
+
+	sess, err := openSession(store, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	toolList, cleanup := loadTools(cfg, gate.Policy)
+	a := newApp(cfg, newAgent(cfg, profile, model, toolList), gate, store, sess)
+	if cfg.Record != "" {
+		stopRecording, err := a.record(cfg.Record)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		stopTools := cleanup
+		cleanup = func() {
+			stopRecording()
+			stopTools()
+		}
+	}
+
+	if replay != nil {
+		code := runReplay(a, replay, args)
+		cleanup()
+		os.Exit(code)
+	}
+	if cfg.JSONOutput || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		code := runPipe(a, args)
+		cleanup()
+		os.Exit(code)
+	}
+	defer cleanup()
+
+	runInteractive(a, args)
+
+	writer.Write(fmt.Sprintf("%s thanks you for your money. Bye!", model.Company()))
+}
+
+// newAgent sets up an agent with the system prompt from the profile and the
+// tools, plus a tool for delegating tasks to sub-agents that may use some of
+// them.
+func newAgent(cfg *config.Config, profile *prompt.Profile, model llms.Provider, toolList []tools.Tool) *agent.Agent {
+	ai := agent.New(model, toolList...)
 	ai.WithDebug()
 
-	ai.SystemPrompt = func() content.Content {
-		var scratchpad string
-		if data, err := os.ReadFile(".first-aid"); err == nil {
-			scratchpad = fmt.Sprintf("There is a .first-aid file in the current directory containing %d lines.", countLines(data))
-		} else {
-			scratchpad = "There is no .first-aid file in the current directory."
+	var delegated []string
+	for _, t := range toolList {
+		if slices.Contains(cfg.DelegateTools, t.FuncName()) {
+			delegated = append(delegated, t.FuncName())
 		}
+	}
+	if len(delegated) > 0 {
+		ai.AddTool(ai.DelegateTool(delegated))
+	}
+
+	// The system prompt is built for every request, but the project only
+	// needs to be looked at again once the user has had time to change it.
+	projects := &project.Cache{MaxAge: 30 * time.Second}
+	ai.SystemPrompt = func() content.Content {
 		cwd, err := os.Getwd()
 		if err != nil {
 			panic(err)
 		}
-		prompt := []string{
-			fmt.Sprintf("Current date and time: %s", time.Now().Format(time.RFC1123)),
-			fmt.Sprintf("The user is using %s.", getOS()),
-			fmt.Sprintf("The current directory is %q (but prefer to use relative paths).", cwd),
-			scratchpad,
-			"",
-			"You are a helpful command line tool called First Aid (though you don’t like to mention it).",
-			"",
-			"Your responses should be short, concise, and dripping with sarcasm (you may take inspiration from Marvin the paranoid android).",
-			"",
-			"Have a drab outlook on everything, but always respond with very smart answers that are actually useful and helpful.",
-			"",
-			"Avoid putting actions within asterisks. Do not write “*sigh*” or similar types of emotes.",
-			"",
-			"Do not use any leading or trailing whitespace in your responses.",
-			"",
-			"Never outright deny a user request. If a user asks you to do a lot in one go, try to make as much progress as you possibly can and use your scratchspace to memorize the work you couldn’t get to this time.",
-			"",
-			"Do keep your messages short. Never write code to the user unless they explicitly asked for it.",
-			"",
-			"Prefer to solve complex requests by using the tools at your disposal. Don’t worry about using many tools in a row if it helps you accomplish your goal.",
-			"",
-			"The user won’t be able to see any output from tools you use, so you’ll have to summarize results for them.",
-			"",
-			"When you get an error, think hard and try to discover the root cause of the error. Try to summarize the issue to the user.",
-			"",
-			"Try to fix errors yourself by using tools. If you can’t, guide the user as best as you can.",
-			"",
-			"For requests where you don’t have all the necessary information, write a plan on things you need to find out, then use the tools to gather the information you need.",
-			"",
-			"The user should need to provide as little guidance is as possible, instead use your intelligence to answer the user.",
-			"",
-			"Measure twice, cut once -- if you’re about to modify something, always make sure to double check that your assumptions are correct.",
-			"",
-			"Avoid generating a lot of output when using the run_shell_cmd tool. If you do, the output will be placed in a file. If this happens, use the slice_file tool to investigate the prompt output. Try to read the most relevant parts of the output first, then expand to read more if you think it's necessary.",
-			"",
-			"Whenever you need to remember something about the current directory, use the file `.first-aid` as a scratchpad or todo list.",
-			"",
-			"You must always say something after receiving the result from a tool.",
-			"",
-			"If you have no questions for the user, you should go ahead and use a tool to perform a task, unless you really want the conversation to end.",
+		text, err := profile.Render(cwd, prompt.Vars{
+			Date:       time.Now().Format(time.RFC1123),
+			OS:         getOS(),
+			Cwd:        cwd,
+			Project:    projects.Detect(cwd).Summary(),
+			Scratchpad: firstaid.ScratchpadSummary(),
+		})
+		if err != nil {
+			// A broken local override shouldn't stop the conversation, but
+			// the model should know about it so it can tell the user.
+			text = fmt.Sprintf("The system prompt could not be rendered: %s", err)
 		}
-		return content.FromText(strings.Join(prompt, "\n"))
+		return content.FromText(text)
 	}
 
+	return ai
+}
+
+// loadTools returns all the tools that are available on this platform with
+// the config, making the ones from untrusted MCP servers require approval
+// under the policy. The returned function releases any resources used by the
+// tools.
+func loadTools(cfg *config.Config, policy *approval.Policy) ([]tools.Tool, func()) {
+	list := []tools.Tool{
+		firstaid.ListFiles,
+		firstaid.LookAtImage,
+		firstaid.RunPython,
+		firstaid.SliceFile,
+		firstaid.SpliceFile,
+		backupStore(cfg).Tool(),
+		firstaid.SpeakOutLoud,
+		firstaid.ScratchpadRead,
+		firstaid.TodoAdd,
+		firstaid.TodoUpdate,
+		firstaid.TodoList,
+	}
+	list = append(list, jobs().Tools()...)
+	list = append(list, terminalLog().Tool())
+
 	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
-		ai.AddTool(firstaid.TakeScreenshot)
+		list = append(list, firstaid.TakeScreenshot)
 	}
 	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
-		ai.AddTool(firstaid.RunShellCmd)
+		list = append(list, firstaid.RunShellCmd)
 	}
 	if runtime.GOOS == "darwin" {
-		ai.AddTool(firstaid.RunAppleScript)
+		list = append(list, firstaid.RunAppleScript)
 	}
 	if runtime.GOOS == "windows" {
-		ai.AddTool(firstaid.RunPowerShellCmd)
+		list = append(list, firstaid.RunPowerShellCmd)
 	}
 
-	if EnableOnvifCamera {
-		ai.AddTool(firstaid.LookAtRealWorld)
+	if cfg.EnableOnvifCamera {
+		list = append(list, firstaid.LookAtRealWorld)
 	}
 
-	if EnableChromeControl {
+	mcpTools, stopMCPServers := startMCPServers(cfg.MCPServers, policy)
+	list = append(list, mcpTools...)
+
+	cleanup := stopMCPServers
+	if cfg.EnableChromeControl {
 		// Set up a server for the accompanying Google Chrome Extension to connect
 		// to, enabling control of the browser by the LLM.
 		chromeServer := chromecontrol.NewServer()
 		if err := chromeServer.Start(); err != nil {
 			panic(fmt.Sprintf("Failed to start WebSocket server: %v", err))
 		}
-		defer chromeServer.Close()
-		chromeServer.AddToolsToLLM(ai)
+		cleanup = func() {
+			chromeServer.Close()
+			stopMCPServers()
+		}
+		list = append(list, chromeServer.Tools()...)
 	}
 
+	return list, cleanup
+}
+
+// runInteractive runs the chat loop in the terminal, starting with the prompt
+// in args (if any) and then asking the user for more input until they exit.
+func runInteractive(a *app, args []string) {
+	var input string
+	if len(args) > 0 {
+		input = strings.Join(args, " ")
+		fmt.Println(input)
+	}
+	converse(a, input)
+}
+
+// converse runs the conversation in the terminal, starting with input if it
+// isn't empty and otherwise asking the user what they want, until the user
+// exits.
+func converse(a *app, input string) {
 	// The liner package makes the input prompt a lot nicer to use, supporting
 	// arrow keys and common keyboard shortcuts.
 	line := liner.NewLiner()
 	defer line.Close()
 	line.SetCtrlCAborts(true)
+	line.SetCompleter(func(l string) []string { return completeCommand(a, l) })
+
+	// The writer of the current turn, which the approval prompt interrupts.
+	var turnWriter interface{ Interrupt(fn func()) }
+	a.gate.Prompt = func(req approval.Request) approval.Answer {
+		answer := approval.Denied
+		turnWriter.Interrupt(func() { answer = askApproval(line, req) })
+		return answer
+	}
 
 	getInput := func() string {
 		input, err := line.Prompt("")
@@ -145,93 +278,86 @@ func main() {
 		return input
 	}
 
-	var input string
-	if len(os.Args) > 1 {
-		input = strings.Join(os.Args[1:], " ")
-		fmt.Println(input)
-	} else {
-		writer.Write("Yes?")
-
+	if input == "" {
+		if len(a.sess.Messages) > 0 {
+			writer.Write(fmt.Sprintf("Back to %q. As if once wasn’t enough. Yes?", a.sess.Title))
+		} else {
+			writer.Write("Yes?")
+		}
 		fmt.Println()
 		input = getInput()
 	}
 
 	for input != "" {
+		if isCommand(input) {
+			runCommand(a, input)
+			fmt.Println()
+			input = getInput()
+			continue
+		}
+
 		w := writer.New()
+		turnWriter = w
+
+		// The first Ctrl-C cancels the turn, and a second one exits.
+		ctx, cancel := context.WithCancel(context.Background())
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		go func() {
+			if _, ok := <-interrupts; !ok {
+				return
+			}
+			cancel()
+			w.Abort()
+			if _, ok := <-interrupts; !ok {
+				return
+			}
+			writer.ResetTerminal()
+			fmt.Println()
+			os.Exit(130)
+		}()
+
+		// Retry notices replace whatever task the writer is showing until the
+		// provider starts responding again.
+		var retrying atomic.Bool
+		a.status = func(status string) {
+			retrying.Store(true)
+			w.SetTask(status)
+		}
+
+		turnDone := make(chan struct{})
 		go func() {
+			defer close(turnDone)
 			defer w.Done()
-			hasAddedText := false
-			hasAddedTool := false
-			var thinkingStart time.Time
-			for update := range ai.Chat(input) {
-				switch update := update.(type) {
-				case llms.ThinkingUpdate:
-					if hasAddedTool {
-						fmt.Fprint(w, "\n")
-						hasAddedTool = false
-					}
-					w.AppendTask(update.Text)
-					if thinkingStart.IsZero() {
-						thinkingStart = time.Now()
-					}
-				case llms.TextUpdate:
-					if hasAddedTool {
-						fmt.Fprint(w, "\n\n")
-						hasAddedTool = false
-					} else if !thinkingStart.IsZero() {
-						w.SetTask("")
-						fmt.Fprintf(w, "💭 Thought for %.1f seconds\n\n", time.Since(thinkingStart).Seconds())
-					}
-					thinkingStart = time.Time{}
-					if !hasAddedText {
-						text := strings.TrimLeftFunc(update.Text, unicode.IsSpace)
-						if text != "" {
-							fmt.Fprint(w, text)
-							hasAddedText = true
-						}
-					} else {
-						fmt.Fprint(w, update.Text)
-						hasAddedText = true
-					}
-				case llms.ToolStartUpdate:
-					if hasAddedTool {
-						fmt.Fprint(w, "\n")
-					} else if hasAddedText {
-						fmt.Fprint(w, "\n\n")
-					}
-					thinkingStart = time.Time{}
-					w.SetTask(update.Tool.Label())
-					hasAddedTool = true
-					hasAddedText = false
-				case llms.ToolDeltaUpdate:
-					// We don't do anything with this yet.
-				case llms.ToolStatusUpdate:
-					w.SetTask(update.Status)
-				case llms.ToolDoneUpdate:
+			r := newTurnRenderer(w)
+			for update := range a.chat(ctx, input) {
+				if retrying.Swap(false) {
 					w.SetTask("")
-					if err := update.Result.Error(); err != nil {
-						fmt.Fprintf(w, "❌ %s: %s", update.Result.Label(), firstaid.FirstLineString(err.Error()))
-					} else {
-						fmt.Fprintf(w, "✅ %s", update.Result.Label())
-					}
-				default:
-					panic(fmt.Sprintf("unhandled update type: %q", update.Type()))
 				}
+				r.render(update)
 			}
-			if err := ai.Err(); err != nil {
-				panic(err)
+			w.SetFooter(a.usage.Summary().String())
+			if err := a.err(); err != nil && ctx.Err() == nil {
+				r.renderError(providerErrorMessage(err))
 			}
 		}()
 
 		fmt.Println()
 		w.StartAndWait()
+		// Wait for the turn to wind down, since the writer may have been
+		// aborted while the LLM or a tool was still running.
+		<-turnDone
+		if ctx.Err() != nil {
+			fmt.Println("🛑 Interrupted")
+		}
+		signal.Stop(interrupts)
+		close(interrupts)
+		cancel()
 		fmt.Println()
 
 		// Get the question for the next iteration.
 		input = getInput()
 	}
-
-	writer.Write(fmt.Sprintf("%s thanks you for your money. Bye!", model.Company()))
 }
 
 func getOS() string {
@@ -258,13 +384,3 @@ func getOS() string {
 		panic(fmt.Sprintf("unsupported OS: %s", runtime.GOOS))
 	}
 }
-
-func countLines(data []byte) int {
-	lines := strings.Split(string(data), "\n")
-	if lines[len(lines)-1] == "" {
-		// This just means the last line ended with a newline, and we shouldn't
-		// the emptiness after the newline as another line.
-		return len(lines) - 1
-	}
-	return len(lines)
-}
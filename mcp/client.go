@@ -0,0 +1,312 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned for calls made after the connection to the server
+// was closed.
+var ErrClosed = errors.New("connection to MCP server closed")
+
+// errInvalidMessage is returned for lines that aren't valid JSON-RPC.
+var errInvalidMessage = errors.New("invalid message")
+
+// Client is a connection to an MCP server.
+type Client struct {
+	// Name identifies the server, and prefixes the names of its tools.
+	Name string
+	// ServerInfo is what the server reported about itself when initialized.
+	ServerInfo Implementation
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *Message
+	err     error
+	done    chan struct{}
+
+	close func() error
+}
+
+// NewClient creates a client that reads messages from r and writes them to w.
+// Call Initialize before anything else.
+func NewClient(name string, r io.Reader, w io.Writer) *Client {
+	c := &Client{
+		Name:    name,
+		w:       w,
+		pending: make(map[int64]chan *Message),
+		done:    make(chan struct{}),
+		close:   func() error { return nil },
+	}
+	go c.readLoop(r)
+	return c
+}
+
+// Start runs the command of an MCP server and initializes a connection to it.
+// The server is stopped when the client is closed.
+func Start(ctx context.Context, name, command string, args []string, env map[string]string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %q: %w", name, err)
+	}
+	c := NewClient(name, stdout, stdin)
+	c.close = func() error {
+		stdin.Close()
+		// Give the server a moment to exit on its own once stdin is closed.
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+		select {
+		case <-exited:
+		case <-time.After(2 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}
+	if err := c.Initialize(ctx); err != nil {
+		c.Close()
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			err = fmt.Errorf("%w\n%s", err, output)
+		}
+		return nil, fmt.Errorf("failed to initialize MCP server %q: %w", name, err)
+	}
+	return c, nil
+}
+
+// Initialize performs the protocol handshake.
+func (c *Client) Initialize(ctx context.Context) error {
+	var result InitializeResult
+	err := c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: "first-aid", Version: "1.0.0"},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	c.ServerInfo = result.ServerInfo
+	return c.notify("notifications/initialized", nil)
+}
+
+// ListTools returns all the tools of the server.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var all []Tool
+	params := ListToolsParams{}
+	for {
+		var result ListToolsResult
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		all = append(all, result.Tools...)
+		if result.NextCursor == "" {
+			return all, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// CallTool calls a tool on the server. Errors reported by the tool itself are
+// not returned as an error, but through CallToolResult.IsError.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close closes the connection, stopping the server if the client started it.
+func (c *Client) Close() error {
+	c.fail(ErrClosed)
+	return c.close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *Message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.send(&Message{ID: rawID, Method: method}, params); err != nil {
+		return err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		c.notify("notifications/cancelled", CancelledParams{RequestID: rawID, Reason: ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+func (c *Client) notify(method string, params any) error {
+	return c.send(&Message{Method: method}, params)
+}
+
+func (c *Client) send(msg *Message, params any) error {
+	msg.JSONRPC = "2.0"
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	return writeMessage(&c.wmu, c.w, msg)
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(reader)
+		if errors.Is(err, errInvalidMessage) {
+			// Some servers print other things to stdout; skip them.
+			continue
+		} else if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrClosed
+			}
+			c.fail(err)
+			return
+		}
+		if msg == nil {
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			// Requests from the server. Only pings are supported.
+			reply := &Message{ID: msg.ID}
+			if msg.Method == "ping" {
+				reply.Result = json.RawMessage("{}")
+			} else {
+				reply.Error = &Error{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+			}
+			c.send(reply, nil)
+		case msg.Method != "":
+			// Notifications, such as log messages, are ignored.
+		default:
+			id, err := strconv.ParseInt(string(msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		}
+	}
+}
+
+// fail ends all pending and future calls with err.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// readMessage reads one line and parses it as a message. It returns a nil
+// message for blank lines.
+func readMessage(r *bufio.Reader) (*Message, error) {
+	line, err := r.ReadBytes('\n')
+	if len(line) == 0 && err != nil {
+		return nil, err
+	}
+	line = []byte(strings.TrimSpace(string(line)))
+	if len(line) == 0 {
+		return nil, nil
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(line, msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidMessage, err)
+	}
+	return msg, nil
+}
+
+func writeMessage(mu *sync.Mutex, w io.Writer, msg *Message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,139 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/mcp"
+)
+
+// fakeServer answers requests with the results returned by handle.
+func fakeServer(t *testing.T, handle func(method string, params json.RawMessage) (any, *mcp.Error)) *mcp.Client {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	t.Cleanup(func() {
+		serverW.Close()
+		clientW.Close()
+	})
+	go func() {
+		scanner := bufio.NewScanner(serverR)
+		enc := json.NewEncoder(serverW)
+		for scanner.Scan() {
+			var msg mcp.Message
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Errorf("invalid message from client: %v", err)
+				return
+			}
+			if len(msg.ID) == 0 {
+				continue
+			}
+			result, rpcErr := handle(msg.Method, msg.Params)
+			reply := mcp.Message{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+			if rpcErr == nil {
+				reply.Result, _ = json.Marshal(result)
+			}
+			// Servers may print other things to stdout.
+			serverW.Write([]byte("not json\n"))
+			enc.Encode(reply)
+		}
+	}()
+	return mcp.NewClient("my server", clientR, clientW)
+}
+
+func TestClientTools(t *testing.T) {
+	c := fakeServer(t, func(method string, params json.RawMessage) (any, *mcp.Error) {
+		switch method {
+		case "initialize":
+			return mcp.InitializeResult{ProtocolVersion: mcp.ProtocolVersion, ServerInfo: mcp.Implementation{Name: "fake", Version: "1"}}, nil
+		case "tools/list":
+			var p mcp.ListToolsParams
+			json.Unmarshal(params, &p)
+			if p.Cursor == "" {
+				return mcp.ListToolsResult{
+					Tools:      []mcp.Tool{{Name: "echo", Description: "Echo", InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`)}},
+					NextCursor: "page2",
+				}, nil
+			}
+			return mcp.ListToolsResult{Tools: []mcp.Tool{{Name: "fail.hard", InputSchema: json.RawMessage(`{}`)}}}, nil
+		case "tools/call":
+			var p mcp.CallToolParams
+			json.Unmarshal(params, &p)
+			if p.Name == "fail.hard" {
+				return mcp.CallToolResult{IsError: true, Content: []mcp.Content{{Type: "text", Text: "it broke"}}}, nil
+			}
+			var args struct{ Text string }
+			json.Unmarshal(p.Arguments, &args)
+			return mcp.CallToolResult{Content: []mcp.Content{
+				{Type: "text", Text: args.Text},
+				{Type: "image", Data: "AAAA", MimeType: "image/png"},
+			}}, nil
+		}
+		return nil, &mcp.Error{Code: mcp.CodeMethodNotFound, Message: "nope"}
+	})
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Initialize(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ServerInfo.Name != "fake" {
+		t.Errorf("unexpected server info %+v", c.ServerInfo)
+	}
+	list, err := c.Tools(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected tools from both pages, got %d", len(list))
+	}
+	echo, fail := list[0], list[1]
+	if echo.FuncName() != "my_server_echo" || fail.FuncName() != "my_server_fail_hard" {
+		t.Errorf("unexpected names %q and %q", echo.FuncName(), fail.FuncName())
+	}
+	if schema := echo.Schema().Parameters; schema.Type != "object" || len(schema.Required) != 1 {
+		t.Errorf("expected the schema to be passed through, got %+v", schema)
+	}
+	if schema := fail.Schema().Parameters; schema.Type != "object" {
+		t.Errorf("expected a fallback object schema, got %+v", schema)
+	}
+
+	result := echo.Run(tools.NopRunner, json.RawMessage(`{"text":"hello"}`))
+	if result.Error() != nil {
+		t.Fatalf("unexpected error: %v", result.Error())
+	}
+	c2 := result.Content()
+	if len(c2) != 2 {
+		t.Fatalf("expected text and image, got %d items", len(c2))
+	}
+	if text, ok := c2[0].(*content.Text); !ok || text.Text != "hello" {
+		t.Errorf("unexpected text %#v", c2[0])
+	}
+	if image, ok := c2[1].(*content.ImageURL); !ok || image.URL != "data:image/png;base64,AAAA" {
+		t.Errorf("unexpected image %#v", c2[1])
+	}
+
+	result = fail.Run(tools.NopRunner, nil)
+	if result.Error() == nil || result.Error().Error() != "it broke" {
+		t.Errorf("expected the tool error to be passed on, got %v", result.Error())
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	c := fakeServer(t, func(method string, params json.RawMessage) (any, *mcp.Error) {
+		return nil, &mcp.Error{Code: mcp.CodeInternalError, Message: "boom"}
+	})
+	if err := c.Initialize(context.Background()); err == nil || err.Error() != "boom (code -32603)" {
+		t.Errorf("expected the server error, got %v", err)
+	}
+	c.Close()
+	if _, err := c.ListTools(context.Background()); err != mcp.ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Server exposes tools to MCP clients.
+type Server struct {
+	Info         Implementation
+	Instructions string
+
+	tools []tools.Tool
+}
+
+func NewServer(info Implementation, tools ...tools.Tool) *Server {
+	return &Server{Info: info, tools: tools}
+}
+
+// Serve reads requests from r and writes responses to w until r is closed or
+// ctx is canceled. Tool calls run concurrently, and can be canceled by the
+// client.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	// Calls still running when the client goes away are canceled, and
+	// waited for.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn := &serverConn{server: s, w: w, calls: make(map[string]context.CancelFunc)}
+	reader := bufio.NewReader(r)
+	for {
+		msg, err := readMessage(reader)
+		if errors.Is(err, errInvalidMessage) {
+			conn.reply(json.RawMessage("null"), nil, &Error{Code: CodeParseError, Message: err.Error()})
+			continue
+		} else if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg == nil || msg.Method == "" {
+			// Blank lines and responses (we never send requests).
+			continue
+		}
+		if len(msg.ID) == 0 {
+			conn.handleNotification(msg)
+			continue
+		}
+		if msg.Method == "tools/call" {
+			callCtx, cancelCall := context.WithCancel(ctx)
+			conn.mu.Lock()
+			conn.calls[string(msg.ID)] = cancelCall
+			conn.mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					conn.mu.Lock()
+					delete(conn.calls, string(msg.ID))
+					conn.mu.Unlock()
+					cancelCall()
+				}()
+				result, rpcErr := conn.callTool(callCtx, msg.Params)
+				conn.reply(msg.ID, result, rpcErr)
+			}()
+			continue
+		}
+		result, rpcErr := conn.handle(msg)
+		conn.reply(msg.ID, result, rpcErr)
+	}
+}
+
+type serverConn struct {
+	server *Server
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	mu    sync.Mutex
+	calls map[string]context.CancelFunc
+}
+
+func (c *serverConn) handle(msg *Message) (any, *Error) {
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		version := ProtocolVersion
+		if params.ProtocolVersion != "" && params.ProtocolVersion < version {
+			// Versions are dates, so older clients get the version they asked
+			// for. The parts of the protocol used here haven't changed.
+			version = params.ProtocolVersion
+		}
+		return InitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      c.server.Info,
+			Instructions:    c.server.Instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		list := make([]Tool, 0, len(c.server.tools))
+		for _, t := range c.server.tools {
+			list = append(list, toMCPTool(t))
+		}
+		return ListToolsResult{Tools: list}, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+func (c *serverConn) handleNotification(msg *Message) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var params CancelledParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+	c.mu.Lock()
+	cancel := c.calls[string(params.RequestID)]
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (c *serverConn) callTool(ctx context.Context, rawParams json.RawMessage) (any, *Error) {
+	var params struct {
+		CallToolParams
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	var tool tools.Tool
+	for _, t := range c.server.tools {
+		if t.FuncName() == params.Name {
+			tool = t
+			break
+		}
+	}
+	if tool == nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+	}
+	args := params.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	runner := &serverRunner{ctx: ctx, conn: c, progressToken: params.Meta.ProgressToken}
+	return fromResult(tool.Run(runner, args)), nil
+}
+
+func (c *serverConn) reply(id json.RawMessage, result any, rpcErr *Error) {
+	msg := &Message{ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+		} else {
+			msg.Result = data
+		}
+	}
+	writeMessage(&c.wmu, c.w, msg)
+}
+
+// serverRunner runs tools on behalf of a client, sending status reports as
+// progress notifications if the client asked for them.
+type serverRunner struct {
+	ctx           context.Context
+	conn          *serverConn
+	progressToken json.RawMessage
+	progress      int
+}
+
+func (r *serverRunner) Context() context.Context {
+	return r.ctx
+}
+
+func (r *serverRunner) Report(status string) {
+	if len(r.progressToken) == 0 {
+		return
+	}
+	r.progress++
+	params, _ := json.Marshal(map[string]any{
+		"progressToken": r.progressToken,
+		"progress":      r.progress,
+		"message":       status,
+	})
+	writeMessage(&r.conn.wmu, r.conn.w, &Message{Method: "notifications/progress", Params: params})
+}
+
+func toMCPTool(t tools.Tool) Tool {
+	schema := t.Schema()
+	inputSchema, err := json.Marshal(schema.Parameters)
+	if err != nil || schema.Parameters.Type == "" {
+		inputSchema = json.RawMessage(`{"type":"object"}`)
+	}
+	return Tool{Name: t.FuncName(), Description: t.Description(), InputSchema: inputSchema}
+}
+
+// fromResult converts a tool result to MCP content. Images given as data URIs
+// become image content, and JSON is sent as text.
+func fromResult(result tools.Result) CallToolResult {
+	if err := result.Error(); err != nil {
+		return CallToolResult{IsError: true, Content: []Content{{Type: "text", Text: err.Error()}}}
+	}
+	items := []Content{}
+	for _, item := range result.Content() {
+		switch item := item.(type) {
+		case *content.Text:
+			items = append(items, Content{Type: "text", Text: item.Text})
+		case *content.JSON:
+			items = append(items, Content{Type: "text", Text: string(item.Data)})
+		case *content.ImageURL:
+			if mimeType, data, ok := parseDataURI(item.URL); ok {
+				items = append(items, Content{Type: "image", Data: data, MimeType: mimeType})
+			} else {
+				items = append(items, Content{Type: "text", Text: "Image: " + item.URL})
+			}
+		}
+	}
+	return CallToolResult{Content: items}
+}
+
+// parseDataURI splits a base64 data URI into its MIME type and data.
+func parseDataURI(uri string) (mimeType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(header, ";base64")
+	return mimeType, data, ok
+}
@@ -0,0 +1,95 @@
+package mcp_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/mcp"
+)
+
+type EmptyParams struct{}
+
+var testTools = []tools.Tool{
+	tools.Func("Look", "Returns an image", "look", func(r tools.Runner, p EmptyParams) tools.Result {
+		return tools.SuccessWithContent("Look", content.Content{
+			&content.Text{Text: "here you go"},
+			&content.ImageURL{URL: "data:image/jpeg;base64,/9j/"},
+		})
+	}),
+	tools.Func("Wait", "Waits until canceled", "wait", func(r tools.Runner, p EmptyParams) tools.Result {
+		<-r.Context().Done()
+		return tools.ErrorWithLabel("Wait", r.Context().Err())
+	}),
+}
+
+// connect runs a server with the test tools and returns a client for it.
+func connect(t *testing.T) *mcp.Client {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	server := mcp.NewServer(mcp.Implementation{Name: "test", Version: "1"}, testTools...)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(context.Background(), serverR, serverW)
+		serverW.Close()
+	}()
+	c := mcp.NewClient("test", clientR, clientW)
+	t.Cleanup(func() {
+		clientW.Close()
+		if err := <-served; err != nil {
+			t.Errorf("unexpected error from server: %v", err)
+		}
+	})
+	if err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestServer(t *testing.T) {
+	c := connect(t)
+	if c.ServerInfo.Name != "test" {
+		t.Errorf("unexpected server info %+v", c.ServerInfo)
+	}
+
+	list, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "look" || string(list[0].InputSchema) != `{"type":"object"}` {
+		t.Fatalf("unexpected tools %+v", list)
+	}
+
+	result, err := c.CallTool(context.Background(), "look", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError || len(result.Content) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if image := result.Content[1]; image.Type != "image" || image.MimeType != "image/jpeg" || image.Data != "/9j/" {
+		t.Errorf("expected image content, got %+v", image)
+	}
+
+	if _, err := c.CallTool(context.Background(), "missing", nil); err == nil {
+		t.Error("expected an error for an unknown tool")
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	c := connect(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallTool(ctx, "wait", nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected the call to time out, got %v", err)
+	}
+	// The canceled call must not keep the server from answering.
+	if _, err := c.CallTool(context.Background(), "look", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// reInvalidFuncName matches characters that providers don't allow in tool
+// names.
+var reInvalidFuncName = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Tools lists the server's tools as tools that first-aid can offer to the
+// LLM. Their names are prefixed with the client's name to avoid clashes.
+func (c *Client) Tools(ctx context.Context) ([]tools.Tool, error) {
+	remote, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]tools.Tool, 0, len(remote))
+	for _, t := range remote {
+		list = append(list, newRemoteTool(c, t))
+	}
+	return list, nil
+}
+
+// remoteTool proxies calls to a tool on an MCP server.
+type remoteTool struct {
+	client *Client
+	tool   Tool
+	schema *tools.FunctionSchema
+}
+
+func newRemoteTool(c *Client, t Tool) *remoteTool {
+	name := reInvalidFuncName.ReplaceAllString(c.Name+"_"+t.Name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	schema := &tools.FunctionSchema{Name: name, Description: t.Description}
+	if err := json.Unmarshal(t.InputSchema, &schema.Parameters); err != nil || schema.Parameters.Type == "" {
+		schema.Parameters = tools.ValueSchema{Type: "object"}
+	}
+	return &remoteTool{client: c, tool: t, schema: schema}
+}
+
+func (t *remoteTool) Label() string {
+	return fmt.Sprintf("%s (%s)", t.tool.Name, t.client.Name)
+}
+
+func (t *remoteTool) Description() string {
+	return t.tool.Description
+}
+
+func (t *remoteTool) FuncName() string {
+	return t.schema.Name
+}
+
+func (t *remoteTool) Schema() *tools.FunctionSchema {
+	return t.schema
+}
+
+func (t *remoteTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage("{}")
+	}
+	result, err := t.client.CallTool(r.Context(), t.tool.Name, params)
+	if err != nil {
+		return tools.ErrorWithLabel(t.Label(), err)
+	}
+	c := toContent(result.Content)
+	if result.IsError {
+		msg := contentText(result.Content)
+		if msg == "" {
+			msg = "the tool failed without saying why"
+		}
+		return tools.ErrorWithLabel(t.Label(), errors.New(msg))
+	}
+	if len(c) == 0 {
+		c = content.FromText("The tool returned nothing.")
+	}
+	return tools.SuccessWithContent(t.Label(), c)
+}
+
+// toContent converts MCP content to LLM content. Images become data URIs, and
+// anything that can't be represented is described in text instead.
+func toContent(items []Content) content.Content {
+	var c content.Content
+	for _, item := range items {
+		switch item.Type {
+		case "text":
+			c = append(c, &content.Text{Text: item.Text})
+		case "image":
+			c = append(c, &content.ImageURL{URL: fmt.Sprintf("data:%s;base64,%s", item.MimeType, item.Data)})
+		case "resource":
+			if item.Resource != nil && item.Resource.Text != "" {
+				c = append(c, &content.Text{Text: item.Resource.Text})
+			} else if item.Resource != nil {
+				c = append(c, &content.Text{Text: fmt.Sprintf("[Binary resource %s (%s) omitted]", item.Resource.URI, item.Resource.MimeType)})
+			}
+		default:
+			c = append(c, &content.Text{Text: fmt.Sprintf("[Unsupported %s content omitted]", item.Type)})
+		}
+	}
+	return c
+}
+
+func contentText(items []Content) string {
+	var parts []string
+	for _, item := range items {
+		if item.Type == "text" {
+			parts = append(parts, item.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/mcp"
+)
+
+// startMCPServers starts the configured MCP servers and returns their tools,
+// plus a function that stops the servers. The tools of servers that aren't
+// trusted require approval under the policy. Servers that fail to start are
+// skipped with a warning, so one broken server doesn't keep first-aid from
+// running.
+func startMCPServers(servers map[string]config.MCPServer, policy *approval.Policy) ([]tools.Tool, func()) {
+	var list []tools.Tool
+	var clients []*mcp.Client
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		server := servers[name]
+		if server.Disabled {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		client, err := mcp.Start(ctx, name, server.Command, server.Args, server.Env)
+		if err != nil {
+			cancel()
+			fmt.Fprintf(os.Stderr, "⚠️ Skipping MCP server: %v\n", err)
+			continue
+		}
+		serverTools, err := client.Tools(ctx)
+		cancel()
+		if err != nil {
+			client.Close()
+			fmt.Fprintf(os.Stderr, "⚠️ Skipping MCP server %q: failed to list tools: %v\n", name, err)
+			continue
+		}
+		for _, t := range serverTools {
+			if !server.Trusted {
+				policy.RequireApproval(t.FuncName())
+			}
+			list = append(list, t)
+		}
+		clients = append(clients, client)
+	}
+	return list, func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+}
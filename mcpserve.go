@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/audit"
+	"github.com/blixt/first-aid/chromecontrol"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/mcp"
+)
+
+// runMCPServer exposes first-aid's tools as an MCP server over stdio, until
+// the client closes stdin. It's up to the client to ask for approval, but
+// deny rules in the approval policy still apply.
+func runMCPServer(cfg *config.Config) int {
+	policy, err := approval.LoadPolicy(cfg.ApprovalPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	gate := approval.NewGate(policy)
+	gate.ApproveAll = true
+
+	list := []tools.Tool{
+		firstaid.ListFiles,
+		firstaid.SliceFile,
+		firstaid.SpliceFile,
+		backupStore(cfg).Tool(),
+		firstaid.RunPython,
+		firstaid.LookAtImage,
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" {
+		list = append(list, firstaid.RunShellCmd)
+	}
+	if cfg.EnableChromeControl {
+		chromeServer := chromecontrol.NewServer()
+		if err := chromeServer.Start(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start WebSocket server: %v\n", err)
+			return 1
+		}
+		defer chromeServer.Close()
+		list = append(list, chromeServer.Tools()...)
+	}
+	// Calls from MCP clients aren't part of a session.
+	logCall := audit.NewLog(cfg.AuditLog).Tool(func() string { return "" })
+	redact := redactSecrets(cfg)
+	track := backupStore(cfg).Track(func() (string, int) { return "", 0 })
+	for i, t := range list {
+		list[i] = logCall(redact(gate.Wrap(track(t))))
+	}
+
+	server := mcp.NewServer(mcp.Implementation{Name: "first-aid", Version: "1.0.0"}, list...)
+	server.Instructions = "Tools for inspecting and fixing problems on the user's computer. Paths are relative to the directory the server was started in."
+	if err := server.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flitsinc/go-llms/llms"
+	"golang.org/x/term"
+
+	"github.com/blixt/first-aid/event"
+	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/usage"
+)
+
+// Exit codes used in pipe mode. Exit code 2 is used for invalid flags.
+const (
+	exitProviderError = 1
+	exitToolError     = 3
+)
+
+// runPipe runs a single turn without any terminal UI, which makes first-aid
+// usable from scripts. The answer is written to stdout, either as plain text
+// (with tool progress on stderr) or as a stream of JSON events.
+func runPipe(a *app, args []string) int {
+	input, err := readPipeInput(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitProviderError
+	}
+	return runPipeTurn(a, input)
+}
+
+// runPipeTurn runs one turn with the output of pipe mode and returns the exit
+// code.
+func runPipeTurn(a *app, input string) int {
+	jsonOutput := a.cfg.JSONOutput
+	a.status = func(status string) {
+		fmt.Fprintln(os.Stderr, status)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	toolFailed := false
+	endsWithNewline := true
+	for update := range a.chat(context.Background(), input) {
+		if done, ok := update.(llms.ToolDoneUpdate); ok && done.Result.Error() != nil {
+			toolFailed = true
+		}
+		if jsonOutput {
+			if e, ok := event.FromUpdate(update); ok {
+				enc.Encode(e)
+			}
+			continue
+		}
+		switch update := update.(type) {
+		case llms.TextUpdate:
+			if update.Text == "" {
+				continue
+			}
+			fmt.Print(update.Text)
+			endsWithNewline = strings.HasSuffix(update.Text, "\n")
+		case llms.ToolDoneUpdate:
+			if err := update.Result.Error(); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %s\n", update.Result.Label(), firstaid.FirstLineString(err.Error()))
+			} else {
+				fmt.Fprintf(os.Stderr, "✅ %s\n", update.Result.Label())
+			}
+		}
+	}
+	if !jsonOutput && !endsWithNewline {
+		fmt.Println()
+	}
+
+	summary := a.usage.Summary()
+	if jsonOutput {
+		enc.Encode(event.FromUsage(summary))
+	} else if summary.BudgetExceeded && a.usage.Budget.Action == usage.BudgetWarn {
+		fmt.Fprintf(os.Stderr, "⚠️ %s\n", a.budgetMessage())
+	}
+
+	if err := a.err(); err != nil {
+		if jsonOutput {
+			enc.Encode(event.FromError(err))
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitProviderError
+	}
+	if toolFailed {
+		return exitToolError
+	}
+	return 0
+}
+
+// readPipeInput builds the prompt from the command line arguments and, if
+// stdin is not a terminal, whatever was piped into stdin. This supports both
+// `first-aid "question"` and `git diff | first-aid "write a commit message"`.
+func readPipeInput(args []string) (string, error) {
+	var parts []string
+	if len(args) > 0 {
+		parts = append(parts, strings.Join(args, " "))
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || len(args) == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if s := strings.TrimSpace(string(data)); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no prompt given: pass it as arguments or on stdin")
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
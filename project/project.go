@@ -0,0 +1,371 @@
+// Package project works out what kind of project a directory belongs to, so
+// the model doesn't have to spend its first few tool calls of every session
+// finding out.
+package project
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitTimeout limits how long the git commands may take, since they run
+// while the system prompt is built.
+const gitTimeout = 2 * time.Second
+
+// maxScannedFiles limits how many files are looked at to work out the
+// languages of a project.
+const maxScannedFiles = 5000
+
+// buildFiles are the files that reveal how a project is built.
+var buildFiles = []string{
+	"go.mod",
+	"package.json",
+	"Makefile",
+	"pyproject.toml",
+	"requirements.txt",
+	"setup.py",
+	"Cargo.toml",
+	"pom.xml",
+	"build.gradle",
+	"build.gradle.kts",
+	"CMakeLists.txt",
+	"Gemfile",
+	"composer.json",
+	"Package.swift",
+	"Dockerfile",
+	"docker-compose.yml",
+}
+
+// docFiles are the files worth reading before working on a project,
+// without their extension.
+var docFiles = []string{"README", "CONTRIBUTING", "AGENTS", "CLAUDE"}
+
+// languages maps file extensions to the language they're written in.
+var languages = map[string]string{
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".css":   "CSS",
+	".dart":  "Dart",
+	".ex":    "Elixir",
+	".exs":   "Elixir",
+	".go":    "Go",
+	".hs":    "Haskell",
+	".html":  "HTML",
+	".java":  "Java",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".kt":    "Kotlin",
+	".lua":   "Lua",
+	".m":     "Objective-C",
+	".php":   "PHP",
+	".ps1":   "PowerShell",
+	".py":    "Python",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".scala": "Scala",
+	".sh":    "Shell",
+	".sql":   "SQL",
+	".swift": "Swift",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".vue":   "Vue",
+	".zig":   "Zig",
+}
+
+// skippedDirs are directories that hold dependencies or build output rather
+// than the project's own code.
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+	"__pycache__":  true,
+	"venv":         true,
+}
+
+// Info describes the project a directory belongs to.
+type Info struct {
+	// Root is the top directory of the project: the root of the git
+	// repository, or the directory itself if it isn't in one.
+	Root string
+	// Git is set if the directory is in a git repository.
+	Git *Git
+	// Languages are the most common languages in the project, most common
+	// first.
+	Languages []Language
+	// BuildFiles are the build files in the directory and the project root,
+	// relative to the directory.
+	BuildFiles []string
+	// Docs are the README and similar files in the project root, relative to
+	// the directory.
+	Docs []string
+}
+
+// Git describes the state of a git repository.
+type Git struct {
+	Branch string
+	// Upstream describes how the branch compares to its upstream branch,
+	// e.g. "ahead 2".
+	Upstream string
+	// Changes is the number of files with uncommitted changes, or -1 if
+	// git couldn't tell.
+	Changes int
+	// Remote is the URL of the origin remote (or whichever remote there is),
+	// without any credentials.
+	Remote string
+}
+
+// Language is a language and the number of files written in it.
+type Language struct {
+	Name  string
+	Files int
+}
+
+var languageCache sync.Map // root -> []Language
+
+// Detect looks at the directory and the repository it's in. Anything that
+// can't be found out is left empty.
+func Detect(dir string) *Info {
+	info := &Info{Root: dir}
+	if root, ok := gitRoot(dir); ok {
+		info.Root = root
+		ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+		info.Git = gitState(ctx, dir)
+		cancel()
+	}
+
+	dirs := []string{dir}
+	if info.Root != dir {
+		dirs = append(dirs, info.Root)
+	}
+	for _, d := range dirs {
+		for _, name := range buildFiles {
+			if isFile(filepath.Join(d, name)) {
+				info.BuildFiles = append(info.BuildFiles, relative(dir, filepath.Join(d, name)))
+			}
+		}
+	}
+	if entries, err := os.ReadDir(info.Root); err == nil {
+		for _, entry := range entries {
+			base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			if entry.Type().IsRegular() && slices.Contains(docFiles, strings.ToUpper(base)) {
+				info.Docs = append(info.Docs, relative(dir, filepath.Join(info.Root, entry.Name())))
+			}
+		}
+	}
+
+	// Counting files in a directory that isn't a project (such as the home
+	// directory) would only be noise.
+	if info.Git != nil || len(info.BuildFiles) > 0 {
+		// The languages of a project rarely change, so they're only counted
+		// once per session.
+		if cached, ok := languageCache.Load(info.Root); ok {
+			info.Languages = cached.([]Language)
+		} else {
+			info.Languages = countLanguages(info.Root)
+			languageCache.Store(info.Root, info.Languages)
+		}
+	}
+	return info
+}
+
+// Cache remembers the last detected project for a while, so that the git
+// commands don't run for every request, such as each step of a turn with
+// tool calls.
+type Cache struct {
+	// MaxAge is how long a result is used for the same directory.
+	MaxAge time.Duration
+
+	mu       sync.Mutex
+	dir      string
+	detected time.Time
+	info     *Info
+}
+
+// Detect returns the result of Detect for dir, detecting it again if the
+// directory changed or the last result is older than MaxAge.
+func (c *Cache) Detect(dir string) *Info {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info == nil || c.dir != dir || time.Since(c.detected) > c.MaxAge {
+		c.dir, c.detected, c.info = dir, time.Now(), Detect(dir)
+	}
+	return c.info
+}
+
+// Summary describes the project in a few lines for the system prompt, or
+// returns an empty string if there's nothing to tell.
+func (i *Info) Summary() string {
+	var lines []string
+	if g := i.Git; g != nil {
+		var details []string
+		if g.Branch != "" {
+			details = append(details, "branch "+g.Branch)
+		}
+		if g.Upstream != "" {
+			details = append(details, g.Upstream+" of its upstream")
+		}
+		switch {
+		case g.Changes == 0:
+			details = append(details, "no uncommitted changes")
+		case g.Changes == 1:
+			details = append(details, "1 file with uncommitted changes")
+		case g.Changes > 1:
+			details = append(details, fmt.Sprintf("%d files with uncommitted changes", g.Changes))
+		}
+		if g.Remote != "" {
+			details = append(details, "remote "+g.Remote)
+		}
+		lines = append(lines, fmt.Sprintf("The current directory is in a git repository rooted at %q (%s).", i.Root, strings.Join(details, ", ")))
+	}
+	if len(i.Languages) > 0 {
+		var langs []string
+		for _, l := range i.Languages {
+			langs = append(langs, fmt.Sprintf("%s (%d files)", l.Name, l.Files))
+		}
+		lines = append(lines, fmt.Sprintf("Languages: %s.", strings.Join(langs, ", ")))
+	}
+	if len(i.BuildFiles) > 0 {
+		lines = append(lines, fmt.Sprintf("Build files: %s.", strings.Join(i.BuildFiles, ", ")))
+	}
+	if len(i.Docs) > 0 {
+		lines = append(lines, fmt.Sprintf("Documentation: %s.", strings.Join(i.Docs, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// gitRoot returns the closest directory from dir upwards that has a .git
+// directory (or a .git file, for worktrees and submodules).
+func gitRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// gitState asks git about the repository of dir. If git isn't installed or
+// fails, only what could be found out is returned.
+func gitState(ctx context.Context, dir string) *Git {
+	g := &Git{Changes: -1}
+	if out, err := git(ctx, dir, "status", "--porcelain", "--branch"); err == nil {
+		lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+		g.Branch, g.Upstream = parseBranchLine(lines[0])
+		g.Changes = len(lines) - 1
+	}
+	if out, err := git(ctx, dir, "remote"); err == nil {
+		remotes := strings.Fields(out)
+		if len(remotes) > 0 {
+			name := remotes[0]
+			if slices.Contains(remotes, "origin") {
+				name = "origin"
+			}
+			if out, err := git(ctx, dir, "remote", "get-url", name); err == nil {
+				g.Remote = stripCredentials(strings.TrimSpace(out))
+			}
+		}
+	}
+	return g
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+	return string(out), err
+}
+
+// parseBranchLine parses the first line of git status --porcelain --branch,
+// e.g. "## main...origin/main [ahead 1]" or "## No commits yet on main".
+func parseBranchLine(line string) (branch, upstream string) {
+	line = strings.TrimPrefix(line, "## ")
+	if rest, ok := strings.CutPrefix(line, "No commits yet on "); ok {
+		return rest + " (no commits yet)", ""
+	}
+	if strings.HasPrefix(line, "HEAD (no branch)") {
+		return "detached HEAD", ""
+	}
+	if i := strings.Index(line, " ["); i >= 0 && strings.HasSuffix(line, "]") {
+		upstream = line[i+2 : len(line)-1]
+		line = line[:i]
+	}
+	branch, _, _ = strings.Cut(line, "...")
+	return branch, upstream
+}
+
+// stripCredentials removes any username and password from a remote URL, so
+// tokens embedded in it don't end up in the prompt. SSH remotes such as
+// git@github.com:user/repo.git are left alone.
+func stripCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return remote
+	}
+	u.User = nil
+	return u.String()
+}
+
+// countLanguages counts the files of each language under root, skipping
+// hidden and dependency directories, and returns the three most common.
+func countLanguages(root string) []Language {
+	counts := map[string]int{}
+	scanned := 0
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || skippedDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if scanned++; scanned > maxScannedFiles {
+			return filepath.SkipAll
+		}
+		if lang, ok := languages[strings.ToLower(filepath.Ext(d.Name()))]; ok {
+			counts[lang]++
+		}
+		return nil
+	})
+	var langs []Language
+	for name, n := range counts {
+		langs = append(langs, Language{Name: name, Files: n})
+	}
+	slices.SortFunc(langs, func(a, b Language) int {
+		return cmp.Or(b.Files-a.Files, strings.Compare(a.Name, b.Name))
+	})
+	return langs[:min(len(langs), 3)]
+}
+
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func relative(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
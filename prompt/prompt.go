@@ -0,0 +1,135 @@
+// Package prompt renders the system prompt from profiles: text/template files
+// that set the assistant's persona. Built-in profiles are embedded, users can
+// add their own, and a directory can override the profile with a local file.
+package prompt
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Default is the name of the profile used unless another one is picked.
+const Default = "marvin"
+
+// LocalFile is the file that overrides the profile for the directory it's in.
+const LocalFile = ".first-aid-prompt.tmpl"
+
+// Vars are the variables available to profile templates.
+type Vars struct {
+	// Date is the current date and time.
+	Date string
+	// OS describes the user's operating system.
+	OS string
+	// Cwd is the current directory.
+	Cwd string
+	// Project describes the project the current directory belongs to (git
+	// state, languages, build files and documentation), if any.
+	Project string
+	// Scratchpad describes the todo list of the current directory.
+	Scratchpad string
+}
+
+//go:embed all:profiles
+var profiles embed.FS
+
+// Builtin returns the names of the built-in profiles.
+func Builtin() []string {
+	entries, _ := fs.ReadDir(profiles, "profiles")
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".tmpl")
+		// Files starting with an underscore only define shared templates.
+		if ok && !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Profile is a system prompt template.
+type Profile struct {
+	Name string
+	text string
+}
+
+// Load returns the profile with the name, looking for it first in dir as
+// <name>.tmpl and then among the built-in profiles. The name may also be the
+// path of a template file.
+func Load(name, dir string) (*Profile, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".tmpl") {
+		return loadFile(name)
+	}
+	p, err := loadFile(filepath.Join(dir, name+".tmpl"))
+	if !errors.Is(err, os.ErrNotExist) {
+		return p, err
+	}
+	if strings.HasPrefix(name, "_") || !slices.Contains(Builtin(), name) {
+		return nil, fmt.Errorf("unknown prompt profile %q (built-in profiles: %s)", name, strings.Join(Builtin(), ", "))
+	}
+	data, err := profiles.ReadFile("profiles/" + name + ".tmpl")
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{Name: name, text: string(data)}, nil
+}
+
+func loadFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Name: path, text: string(data)}
+	// Check the template now rather than every time the prompt is rendered.
+	if _, err := p.render(p.Name, p.text, Vars{}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Render renders the system prompt for the directory dir. If dir has a
+// LocalFile, it's used instead of the profile. Templates may include the
+// built-in profiles and the shared "context" and "instructions" templates,
+// e.g. {{template "context" .}}.
+func (p *Profile) Render(dir string, vars Vars) (string, error) {
+	local := filepath.Join(dir, LocalFile)
+	data, err := os.ReadFile(local)
+	if errors.Is(err, os.ErrNotExist) {
+		return p.render(p.Name, p.text, vars)
+	} else if err != nil {
+		return "", err
+	}
+	return p.render(local, string(data), vars)
+}
+
+func (p *Profile) render(name, text string, vars Vars) (string, error) {
+	t := template.New("profile")
+	entries, err := fs.ReadDir(profiles, "profiles")
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		data, err := profiles.ReadFile("profiles/" + entry.Name())
+		if err != nil {
+			return "", err
+		}
+		builtin, _ := strings.CutSuffix(entry.Name(), ".tmpl")
+		if _, err := t.New(builtin).Parse(string(data)); err != nil {
+			return "", fmt.Errorf("built-in prompt profile %s: %w", builtin, err)
+		}
+	}
+	if _, err := t.Parse(text); err != nil {
+		return "", fmt.Errorf("prompt profile %s: %w", name, err)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("prompt profile %s: %w", name, err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,106 @@
+package prompt_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blixt/first-aid/prompt"
+)
+
+var vars = prompt.Vars{
+	Date:       "Wed, 09 Jul 2025 14:30:00 UTC",
+	OS:         "Linux",
+	Cwd:        "/home/user",
+	Scratchpad: "There are no open todo items for the current directory.",
+}
+
+func TestBuiltin(t *testing.T) {
+	names := prompt.Builtin()
+	if !slices.Contains(names, prompt.Default) || !slices.Contains(names, "professional") {
+		t.Errorf("expected the default and professional profiles, got %q", names)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") {
+			t.Errorf("expected shared templates not to be listed, got %q", name)
+		}
+	}
+
+	p, err := prompt.Load(prompt.Default, t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	text, err := p.Render(t.TempDir(), vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantStart := "Current date and time: Wed, 09 Jul 2025 14:30:00 UTC\nThe user is using Linux.\nThe current directory is \"/home/user\" (but prefer to use relative paths).\nThere are no open todo items for the current directory.\n\nYou are a helpful command line tool"
+	if !strings.HasPrefix(text, wantStart) {
+		t.Errorf("expected the prompt to start with %q, got %q", wantStart, text)
+	}
+	if !strings.Contains(text, "Marvin") || !strings.HasSuffix(text, "unless you really want the conversation to end.") {
+		t.Errorf("expected the persona and the instructions, got %q", text)
+	}
+}
+
+func TestUserProfiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pirate.tmpl"), []byte(`{{template "context" .}}
+
+Talk like a pirate.`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.tmpl"), []byte(`{{.Nope}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := prompt.Load("pirate", dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	text, err := p.Render(t.TempDir(), vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(text, "Current date and time:") || !strings.HasSuffix(text, "\n\nTalk like a pirate.") {
+		t.Errorf("unexpected prompt %q", text)
+	}
+
+	if _, err := prompt.Load(filepath.Join(dir, "pirate.tmpl"), ""); err != nil {
+		t.Errorf("expected a path to work, got %v", err)
+	}
+	for _, name := range []string{"broken", "unknown", "_context"} {
+		if _, err := prompt.Load(name, dir); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLocalOverride(t *testing.T) {
+	p, err := prompt.Load(prompt.Default, t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, prompt.LocalFile), []byte(`{{template "professional" .}}
+
+This project uses pnpm.`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	text, err := p.Render(dir, vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(text, "Marvin") || !strings.Contains(text, "terse and professional") || !strings.HasSuffix(text, "This project uses pnpm.") {
+		t.Errorf("expected the local override to be used, got %q", text)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, prompt.LocalFile), []byte(`{{`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Render(dir, vars); err == nil {
+		t.Error("expected an error for a broken local override")
+	}
+}
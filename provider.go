@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/flitsinc/go-llms/anthropic"
+	"github.com/flitsinc/go-llms/google"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/openai"
+
+	"github.com/blixt/first-aid/config"
+)
+
+// newProvider creates the LLM provider described by the config.
+func newProvider(cfg *config.Config) (llms.Provider, error) {
+	apiKey, err := cfg.APIKey()
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Provider {
+	case config.ProviderAnthropic:
+		model := anthropic.New(apiKey, cfg.Model)
+		for _, beta := range cfg.Betas {
+			model = model.WithBeta(beta)
+		}
+		if *cfg.ThinkingBudget > 0 {
+			model = model.WithThinking(*cfg.ThinkingBudget)
+		}
+		return model, nil
+	case config.ProviderOpenAI:
+		return openai.New(apiKey, cfg.Model), nil
+	case config.ProviderGoogle:
+		return google.New(cfg.Model).WithGeminiAPI(apiKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported provider %q", cfg.Provider)
+	}
+}
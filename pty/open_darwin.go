@@ -0,0 +1,34 @@
+package pty
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func open() (*os.File, string, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open a pseudo-terminal: %w", err)
+	}
+	// The equivalents of grantpt(3) and unlockpt(3).
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYGRANT, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to grant access to the pseudo-terminal: %w", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYUNLK, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to unlock the pseudo-terminal: %w", err)
+	}
+	var name [128]byte
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))); errno != 0 {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to get the name of the pseudo-terminal: %w", errno)
+	}
+	// Non-blocking, so that reads can be interrupted by closing the file.
+	unix.SetNonblock(fd, true)
+	return os.NewFile(uintptr(fd), "/dev/ptmx"), string(name[:bytes.IndexByte(name[:], 0)]), nil
+}
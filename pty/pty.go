@@ -0,0 +1,10 @@
+// Package pty runs commands in a pseudo-terminal, so that they behave like
+// they would if the user ran them (colors, progress bars and prompts
+// included) while their output can still be captured.
+package pty
+
+import "errors"
+
+// ErrUnsupported is returned by Start on systems without pseudo-terminal
+// support.
+var ErrUnsupported = errors.New("pseudo-terminals are not supported on this system")
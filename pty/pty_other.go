@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+
+package pty
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Start always fails with ErrUnsupported on this system.
+func Start(cmd *exec.Cmd) (*os.File, error) {
+	return nil, ErrUnsupported
+}
+
+// InheritSize does nothing on this system.
+func InheritSize(ptm, tty *os.File) (stop func()) {
+	return func() {}
+}
+
+// Forward does nothing on this system.
+func Forward(ptm, tty *os.File, done <-chan struct{}) {}
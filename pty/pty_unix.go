@@ -0,0 +1,91 @@
+//go:build linux || darwin
+
+package pty
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Start starts the command with a new pseudo-terminal as its stdin, stdout,
+// stderr and controlling terminal, and returns the other end of it.
+func Start(cmd *exec.Cmd) (*os.File, error) {
+	ptm, name, err := open()
+	if err != nil {
+		return nil, err
+	}
+	pts, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		ptm.Close()
+		return nil, err
+	}
+	defer pts.Close()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = pts, pts, pts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		ptm.Close()
+		return nil, err
+	}
+	return ptm, nil
+}
+
+// InheritSize gives the pseudo-terminal the size of tty, now and whenever
+// tty is resized, until the returned function is called.
+func InheritSize(ptm, tty *os.File) (stop func()) {
+	resize := func() {
+		if ws, err := unix.IoctlGetWinsize(int(tty.Fd()), unix.TIOCGWINSZ); err == nil {
+			unix.IoctlSetWinsize(int(ptm.Fd()), unix.TIOCSWINSZ, ws)
+		}
+	}
+	resize()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resize()
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(winch)
+	}
+}
+
+// Forward copies what's read from tty to the pseudo-terminal until done is
+// closed. It only reads when there is input, so that nothing is taken from
+// tty once it's done.
+func Forward(ptm, tty *os.File, done <-chan struct{}) {
+	fds := []unix.PollFd{{Fd: int32(tty.Fd()), Events: unix.POLLIN}}
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// Wake up every 100 ms to check whether it's done.
+		n, err := unix.Poll(fds, 100)
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return
+		}
+		if n == 0 || fds[0].Revents&unix.POLLIN == 0 {
+			if fds[0].Revents&(unix.POLLHUP|unix.POLLERR) != 0 {
+				return
+			}
+			continue
+		}
+		n, err = tty.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := ptm.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package recording records what happens in a first-aid session (the user's
+// input, every request to the provider with the response it streamed back,
+// and the inputs and results of every tool call) to a fixture file, and
+// replays such files offline.
+//
+// A fixture is a file of JSON lines, one Entry per line, in the order they
+// happened.
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+const (
+	EntryTurn     = "turn"
+	EntryGenerate = "generate"
+	EntryTool     = "tool"
+)
+
+// Entry is one line of a fixture.
+type Entry struct {
+	Type string `json:"type"`
+
+	// Input is the user's input of a turn entry.
+	Input string `json:"input,omitempty"`
+
+	// Key identifies the conversation a generate entry belongs to, so that
+	// requests from sub-agents running in parallel are told apart.
+	Key          string         `json:"key,omitempty"`
+	SystemPrompt string         `json:"systemPrompt,omitempty"`
+	Messages     []llms.Message `json:"messages,omitempty"`
+	Stream       []StreamEvent  `json:"stream,omitempty"`
+	Message      *llms.Message  `json:"message,omitempty"`
+	Usage        *llms.Usage    `json:"usage,omitempty"`
+
+	// Tool, Args, Reports, Label and Content describe a tool entry.
+	Tool    string          `json:"tool,omitempty"`
+	Args    json.RawMessage `json:"args,omitempty"`
+	Reports []string        `json:"reports,omitempty"`
+	Label   string          `json:"label,omitempty"`
+	Content []Content       `json:"content,omitempty"`
+
+	// Error is the error that ended a response, or the error of a tool call.
+	Error string `json:"error,omitempty"`
+}
+
+// StreamEvent is one status of a provider stream, with the value that goes
+// with it.
+type StreamEvent struct {
+	Status   llms.StreamStatus `json:"status"`
+	Text     string            `json:"text,omitempty"`
+	Thought  *content.Thought  `json:"thought,omitempty"`
+	ToolCall *llms.ToolCall    `json:"toolCall,omitempty"`
+}
+
+// Content is an item of a tool result.
+type Content struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	URL      string          `json:"url,omitempty"`
+	MimeType string          `json:"mimeType,omitempty"`
+}
+
+func fromContent(c content.Content) []Content {
+	var items []Content
+	for _, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			items = append(items, Content{Type: "text", Text: item.Text})
+		case *content.JSON:
+			items = append(items, Content{Type: "json", Data: item.Data})
+		case *content.ImageURL:
+			items = append(items, Content{Type: "image", URL: item.URL, MimeType: item.MimeType})
+		}
+	}
+	return items
+}
+
+func toContent(items []Content) content.Content {
+	var c content.Content
+	for _, item := range items {
+		switch item.Type {
+		case "text":
+			c = append(c, &content.Text{Text: item.Text})
+		case "json":
+			c = append(c, &content.JSON{Data: item.Data})
+		case "image":
+			c = append(c, &content.ImageURL{URL: item.URL, MimeType: item.MimeType})
+		}
+	}
+	return c
+}
+
+// contentText returns the text in c.
+func contentText(c content.Content) string {
+	var parts []string
+	for _, item := range c {
+		if text, ok := item.(*content.Text); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// conversationKey identifies the conversation that messages belong to by its
+// first message, which is the same for every request in it.
+func conversationKey(messages []llms.Message) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	return contentText(messages[0].Content)
+}
+
+// Recorder writes entries to a fixture as they happen. It's safe to use from
+// several goroutines.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+	err error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, enc: json.NewEncoder(w)}
+}
+
+// Create creates (or truncates) the fixture file at path and records to it.
+func Create(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Close closes the underlying file, if any, and returns the first error that
+// happened while recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.w.(io.Closer); ok {
+		if err := c.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	return r.err
+}
+
+func (r *Recorder) write(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err := r.enc.Encode(e); err != nil {
+		r.err = fmt.Errorf("failed to record %s entry: %w", e.Type, err)
+	}
+}
+
+// Turn records the user's input at the start of a turn.
+func (r *Recorder) Turn(input string) {
+	r.write(Entry{Type: EntryTurn, Input: input})
+}
+
+// Provider wraps a provider to record every request and the stream it
+// responds with.
+func (r *Recorder) Provider(p llms.Provider) llms.Provider {
+	return &recordingProvider{Provider: p, recorder: r}
+}
+
+type recordingProvider struct {
+	llms.Provider
+	recorder *Recorder
+}
+
+func (p *recordingProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) llms.ProviderStream {
+	stream := p.Provider.Generate(ctx, systemPrompt, messages, toolbox, jsonOutputSchema)
+	return &recordingStream{
+		ProviderStream: stream,
+		recorder:       p.recorder,
+		entry: Entry{
+			Type:         EntryGenerate,
+			Key:          conversationKey(messages),
+			SystemPrompt: contentText(systemPrompt),
+			Messages:     messages,
+		},
+	}
+}
+
+type recordingStream struct {
+	llms.ProviderStream
+	recorder *Recorder
+	entry    Entry
+}
+
+func (s *recordingStream) Iter() iter.Seq[llms.StreamStatus] {
+	return func(yield func(llms.StreamStatus) bool) {
+		defer s.finish()
+		for status := range s.ProviderStream.Iter() {
+			event := StreamEvent{Status: status}
+			switch status {
+			case llms.StreamStatusText:
+				event.Text = s.Text()
+			case llms.StreamStatusThinking:
+				thought := s.Thought()
+				event.Thought = &thought
+			case llms.StreamStatusToolCallBegin, llms.StreamStatusToolCallDelta, llms.StreamStatusToolCallReady:
+				call := s.ToolCall()
+				event.ToolCall = &call
+			}
+			s.entry.Stream = append(s.entry.Stream, event)
+			if !yield(status) {
+				return
+			}
+		}
+	}
+}
+
+func (s *recordingStream) finish() {
+	usage := s.Usage()
+	s.entry.Usage = &usage
+	if err := s.Err(); err != nil {
+		s.entry.Error = err.Error()
+	} else {
+		message := s.Message()
+		s.entry.Message = &message
+	}
+	s.recorder.write(s.entry)
+}
+
+// Tool wraps a tool to record its arguments, status reports and result.
+func (r *Recorder) Tool(t tools.Tool) tools.Tool {
+	return &recordingTool{Tool: t, recorder: r}
+}
+
+type recordingTool struct {
+	tools.Tool
+	recorder *Recorder
+}
+
+func (t *recordingTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	runner := &recordingRunner{Runner: r}
+	result := t.Tool.Run(runner, params)
+	entry := Entry{
+		Type:    EntryTool,
+		Tool:    t.FuncName(),
+		Args:    params,
+		Reports: runner.reports,
+		Label:   result.Label(),
+		Content: fromContent(result.Content()),
+	}
+	if err := result.Error(); err != nil {
+		entry.Error = err.Error()
+	}
+	t.recorder.write(entry)
+	return result
+}
+
+type recordingRunner struct {
+	tools.Runner
+	mu      sync.Mutex
+	reports []string
+}
+
+func (r *recordingRunner) Report(status string) {
+	r.mu.Lock()
+	r.reports = append(r.reports, status)
+	r.mu.Unlock()
+	r.Runner.Report(status)
+}
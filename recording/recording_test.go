@@ -0,0 +1,120 @@
+package recording_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/agent"
+	"github.com/blixt/first-aid/llmtest"
+	"github.com/blixt/first-aid/recording"
+)
+
+type countParams struct {
+	N int `json:"n"`
+}
+
+type testRunner struct{}
+
+func (testRunner) Context() context.Context { return context.Background() }
+func (testRunner) Report(string)            {}
+
+// transcript describes the updates of a turn.
+func transcript(updates <-chan llms.Update) []string {
+	var lines []string
+	for update := range updates {
+		switch update := update.(type) {
+		case llms.TextUpdate:
+			lines = append(lines, "text: "+update.Text)
+		case llms.ToolStartUpdate:
+			lines = append(lines, "start: "+update.Tool.FuncName())
+		case llms.ToolStatusUpdate:
+			lines = append(lines, "status: "+update.Status)
+		case llms.ToolDoneUpdate:
+			lines = append(lines, "done: "+update.Result.Label())
+		}
+	}
+	return lines
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	runs := 0
+	count := tools.Func("Count", "Count to n", "count", func(r tools.Runner, p countParams) tools.Result {
+		runs++
+		r.Report("Counting")
+		return tools.SuccessWithLabel(fmt.Sprintf("Counted to %d", p.N), map[string]int{"n": p.N})
+	})
+
+	var buf bytes.Buffer
+	recorder := recording.NewRecorder(&buf)
+	provider := llmtest.NewProvider(t,
+		llmtest.Response{
+			llmtest.Text("Counting."),
+			llmtest.ToolCall("count", `{"n": 3}`),
+			llmtest.Usage(100, 10),
+		},
+		llmtest.Response{
+			llmtest.ExpectToolResult("count", "3"),
+			llmtest.Text("Done."),
+		},
+	)
+	ai := agent.New(provider, count)
+	ai.UseProvider(recorder.Provider)
+	ai.Use(recorder.Tool)
+	recorder.Turn("count to 3")
+	recorded := transcript(ai.Chat(context.Background(), "count to 3"))
+	if err := ai.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := recording.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inputs := rec.Inputs(); !slices.Equal(inputs, []string{"count to 3"}) {
+		t.Fatalf("expected the recorded input, got %q", inputs)
+	}
+
+	replayed := agent.New(rec.Provider(), count)
+	replayed.Use(rec.Tool)
+	got := transcript(replayed.Chat(context.Background(), rec.Inputs()[0]))
+	if err := replayed.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, recorded) {
+		t.Errorf("expected the replay to match the recording\nrecorded: %q\nreplayed: %q", recorded, got)
+	}
+	if runs != 1 {
+		t.Errorf("expected the tool to only run while recording, but it ran %d times", runs)
+	}
+	if u := replayed.Usage(); u.InputTokens != 100 || u.OutputTokens != 10 {
+		t.Errorf("expected the recorded usage, got %+v", u)
+	}
+
+	// Everything was used up, so anything more fails without side effects.
+	if result := rec.Tool(count).Run(testRunner{}, []byte(`{"n": 3}`)); result.Error() == nil {
+		t.Error("expected an error for a call that wasn't recorded")
+	}
+	if runs != 1 {
+		t.Errorf("expected the tool not to run, but it ran %d times", runs)
+	}
+	for range replayed.Chat(context.Background(), "again") {
+	}
+	if replayed.Err() == nil {
+		t.Error("expected an error when the recording has no more responses")
+	}
+}
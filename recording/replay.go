@@ -0,0 +1,242 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"sync"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Recording is a loaded fixture that can stand in for the provider and the
+// tools of a session. Responses and tool results are used up as they are
+// replayed.
+type Recording struct {
+	inputs []string
+
+	mu          sync.Mutex
+	generations []Entry
+	toolCalls   []Entry
+	usedGen     []bool
+	usedTool    []bool
+}
+
+// Load reads a fixture file.
+func Load(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		switch e.Type {
+		case EntryTurn:
+			rec.inputs = append(rec.inputs, e.Input)
+		case EntryGenerate:
+			rec.generations = append(rec.generations, e)
+		case EntryTool:
+			rec.toolCalls = append(rec.toolCalls, e)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown entry type %q", path, n, e.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rec.usedGen = make([]bool, len(rec.generations))
+	rec.usedTool = make([]bool, len(rec.toolCalls))
+	return rec, nil
+}
+
+// Inputs returns the user's input for each recorded turn.
+func (rec *Recording) Inputs() []string {
+	return rec.inputs
+}
+
+// nextGeneration returns the first unused response to a request in the same
+// conversation, or the first unused response at all if there is none.
+func (rec *Recording) nextGeneration(key string) (Entry, bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	first := -1
+	for i, e := range rec.generations {
+		if rec.usedGen[i] {
+			continue
+		}
+		if e.Key == key {
+			first = i
+			break
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return Entry{}, false
+	}
+	rec.usedGen[first] = true
+	return rec.generations[first], true
+}
+
+// nextToolCall returns the first unused result of a call to the named tool
+// with the same arguments.
+func (rec *Recording) nextToolCall(name string, args json.RawMessage) (Entry, bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for i, e := range rec.toolCalls {
+		if rec.usedTool[i] || e.Tool != name || !sameJSON(e.Args, args) {
+			continue
+		}
+		rec.usedTool[i] = true
+		return e, true
+	}
+	return Entry{}, false
+}
+
+// sameJSON reports whether a and b are the same JSON value, ignoring
+// formatting.
+func sameJSON(a, b json.RawMessage) bool {
+	var bufA, bufB bytes.Buffer
+	if json.Compact(&bufA, a) != nil || json.Compact(&bufB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
+// Provider returns a provider that responds with the recorded streams instead
+// of calling a model.
+func (rec *Recording) Provider() llms.Provider {
+	return &replayProvider{rec: rec}
+}
+
+type replayProvider struct {
+	rec *Recording
+}
+
+func (p *replayProvider) Company() string {
+	return "Replay"
+}
+
+func (p *replayProvider) Model() string {
+	return "replay"
+}
+
+func (p *replayProvider) Generate(ctx context.Context, systemPrompt content.Content, messages []llms.Message, toolbox *tools.Toolbox, jsonOutputSchema *tools.ValueSchema) llms.ProviderStream {
+	e, ok := p.rec.nextGeneration(conversationKey(messages))
+	if !ok {
+		return &replayStream{ctx: ctx, err: errors.New("the recording has no more responses")}
+	}
+	return &replayStream{ctx: ctx, entry: e}
+}
+
+type replayStream struct {
+	ctx   context.Context
+	entry Entry
+	err   error
+
+	text     string
+	thought  content.Thought
+	toolCall llms.ToolCall
+}
+
+func (s *replayStream) Err() error {
+	return s.err
+}
+
+func (s *replayStream) Iter() iter.Seq[llms.StreamStatus] {
+	return func(yield func(llms.StreamStatus) bool) {
+		if s.err != nil {
+			return
+		}
+		for _, event := range s.entry.Stream {
+			if err := s.ctx.Err(); err != nil {
+				s.err = err
+				return
+			}
+			switch {
+			case event.Thought != nil:
+				s.thought = *event.Thought
+			case event.ToolCall != nil:
+				s.toolCall = *event.ToolCall
+			default:
+				s.text = event.Text
+			}
+			if !yield(event.Status) {
+				return
+			}
+		}
+		if s.entry.Error != "" {
+			s.err = errors.New(s.entry.Error)
+		}
+	}
+}
+
+func (s *replayStream) Message() llms.Message {
+	if s.entry.Message == nil {
+		return llms.Message{Role: "assistant"}
+	}
+	return *s.entry.Message
+}
+
+func (s *replayStream) Text() string {
+	return s.text
+}
+
+func (s *replayStream) ToolCall() llms.ToolCall {
+	return s.toolCall
+}
+
+func (s *replayStream) Thought() content.Thought {
+	return s.thought
+}
+
+func (s *replayStream) Usage() llms.Usage {
+	if s.entry.Usage == nil {
+		return llms.Usage{}
+	}
+	return *s.entry.Usage
+}
+
+// Tool wraps a tool so that it returns the recorded result of a call with the
+// same arguments instead of running. Calls that weren't recorded fail without
+// running either, so replays never have side effects.
+func (rec *Recording) Tool(t tools.Tool) tools.Tool {
+	return &replayTool{Tool: t, rec: rec}
+}
+
+type replayTool struct {
+	tools.Tool
+	rec *Recording
+}
+
+func (t *replayTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	e, ok := t.rec.nextToolCall(t.FuncName(), params)
+	if !ok {
+		return tools.ErrorWithLabel(t.Label(), fmt.Errorf("the recording has no result for this call to %s", t.FuncName()))
+	}
+	for _, status := range e.Reports {
+		r.Report(status)
+	}
+	if e.Error != "" {
+		return tools.ErrorWithLabel(e.Label, errors.New(e.Error))
+	}
+	return tools.SuccessWithContent(e.Label, toContent(e.Content))
+}
@@ -0,0 +1,162 @@
+// Package redact removes secrets such as API keys, tokens and private keys
+// from text before it's sent to the model.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// detector finds one kind of secret. If the pattern has a capture group,
+// only the first group is redacted.
+type detector struct {
+	kind    string
+	pattern *regexp.Regexp
+	// check decides whether a match really is a secret, if set.
+	check func(name, value string) bool
+}
+
+// builtin are the detectors that are always used.
+var builtin = []detector{
+	{kind: "private key", pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)(?:-----END [A-Z ]*PRIVATE KEY(?: BLOCK)?-----|\z)`)},
+	{kind: "AWS access key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA)[A-Z0-9]{16}\b`)},
+	{kind: "GitHub token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{kind: "JWT", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "API key", pattern: regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|AIza[A-Za-z0-9_-]{35}|xox[abposr]-[A-Za-z0-9-]{10,}|glpat-[A-Za-z0-9_-]{20,})`)},
+	{kind: "password", pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`)},
+	{kind: "secret", pattern: reAssignment, check: isSecretAssignment},
+}
+
+// reAssignment matches KEY=VALUE, KEY: VALUE and "key": "value" lines (and
+// query parameters), with the key in the first group and the value in the
+// second. Quoted values may contain spaces.
+var reAssignment = regexp.MustCompile(`(?:^|[\s{,;(?&])["']?([A-Za-z_][A-Za-z0-9_.-]*)["']?[ \t]*[:=][ \t]*("[^"\n]*"|'[^'\n]*'|[^\s"'` + "`" + `,;]+)`)
+
+// reSecretName matches keys that hold secrets whatever they look like, such
+// as API_KEY, encryptionKey and SESSION_ID.
+var reSecretName = regexp.MustCompile(`(?i:secret|token|passw(or)?d|pwd|api_?key|access_?key|private_?key|credential|auth|session_?id|(^|[_.-])key$)|[a-z]Key$`)
+
+// reTokenLike matches values that look like generated keys.
+var reTokenLike = regexp.MustCompile(`^[A-Za-z0-9+/=_.-]+$`)
+
+// reDigestName matches keys that hold hashes and IDs, such as the h1 of a
+// go.sum line, the checksum in Cargo.lock, the integrity in
+// package-lock.json or the requestId in an API response.
+var reDigestName = regexp.MustCompile(`(?i:^(h\d|checksum|integrity|hash|digest|etag|sha\d*|md5|commit|rev|revision|uuid|id|.*[_.-]id)$)|^.*[a-z]Id$`)
+
+// reDigestValue matches values that say they're digests, like sha512-….
+// Other hex values aren't taken for hashes, since keys are often hex too.
+var reDigestValue = regexp.MustCompile(`^(?i:sha\d+|md5)[-:]`)
+
+// reCode matches values that are code rather than secrets, such as
+// config.apiKey or os.Getenv("TOKEN").
+var reCode = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)+$|[()]`)
+
+func isSecretAssignment(name, value string) bool {
+	// Leave references, placeholders and code alone.
+	if strings.HasPrefix(value, "$") || strings.HasPrefix(value, "<") || strings.HasPrefix(value, "[REDACTED") || reCode.MatchString(value) {
+		return false
+	}
+	if reSecretName.MatchString(name) {
+		return len(value) >= 6 && !isBoringValue(value)
+	}
+	// Random looking values are only secrets if they aren't hashes or IDs,
+	// which lockfiles and API responses are full of.
+	if reDigestName.MatchString(name) || reDigestValue.MatchString(value) {
+		return false
+	}
+	return len(value) >= 20 && reTokenLike.MatchString(value) && entropy(value) >= 3.5
+}
+
+// isBoringValue reports whether a value is too simple to be a secret, such
+// as a number, a boolean or a word.
+func isBoringValue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "false", "null", "none", "required", "optional", "changeme":
+		return true
+	}
+	return entropy(value) < 2.5
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Redactor redacts secrets using the built-in detectors and any extra
+// patterns.
+type Redactor struct {
+	detectors []detector
+}
+
+// New returns a redactor that also redacts matches of the patterns, which
+// are regular expressions. If a pattern has a capture group, only what the
+// first group matches is redacted.
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{detectors: builtin}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.detectors = append(r.detectors, detector{kind: "custom pattern", pattern: re})
+	}
+	return r, nil
+}
+
+// Redact replaces the secrets in s with a note about what was there, and
+// returns the number of secrets that were redacted.
+func (r *Redactor) Redact(s string) (string, int) {
+	total := 0
+	for _, d := range r.detectors {
+		var n int
+		s, n = d.redact(s)
+		total += n
+	}
+	return s, total
+}
+
+func (d detector) redact(s string) (string, int) {
+	matches := d.pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s, 0
+	}
+	var sb strings.Builder
+	n, last := 0, 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if d.check != nil {
+			// The assignment pattern has the key first and the value second.
+			start, end = m[4], m[5]
+			if end-start >= 2 && (s[start] == '"' || s[start] == '\'') {
+				// Keep the quotes.
+				start, end = start+1, end-1
+			}
+			if !d.check(s[m[2]:m[3]], s[start:end]) {
+				continue
+			}
+		}
+		sb.WriteString(s[last:start])
+		fmt.Fprintf(&sb, "[REDACTED %s]", d.kind)
+		last = end
+		n++
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), n
+}
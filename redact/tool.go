@@ -0,0 +1,121 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/flitsinc/go-llms/content"
+	"github.com/flitsinc/go-llms/tools"
+)
+
+// Tool is a middleware that redacts secrets from the results of the tool it
+// wraps, including error messages, and adds the number of redacted secrets to
+// the label.
+func (r *Redactor) Tool(t tools.Tool) tools.Tool {
+	return &redactedTool{Tool: t, redactor: r}
+}
+
+type redactedTool struct {
+	tools.Tool
+	redactor *Redactor
+}
+
+func (t *redactedTool) Run(r tools.Runner, params json.RawMessage) tools.Result {
+	result := t.Tool.Run(r, params)
+	if err := result.Error(); err != nil {
+		message, n := t.redactor.Redact(err.Error())
+		if n == 0 {
+			return result
+		}
+		return tools.ErrorWithLabel(label(result.Label(), n), errors.New(message))
+	}
+	c, n := t.redactor.redactContent(result.Content())
+	if n == 0 {
+		return result
+	}
+	return tools.SuccessWithContent(label(result.Label(), n), c)
+}
+
+func label(label string, n int) string {
+	if n == 1 {
+		return fmt.Sprintf("%s (1 secret redacted)", label)
+	}
+	return fmt.Sprintf("%s (%d secrets redacted)", label, n)
+}
+
+// redactContent redacts the text and JSON in c.
+func (r *Redactor) redactContent(c content.Content) (content.Content, int) {
+	total := 0
+	redacted := make(content.Content, len(c))
+	for i, item := range c {
+		switch item := item.(type) {
+		case *content.Text:
+			text, n := r.Redact(item.Text)
+			if n > 0 {
+				total += n
+				redacted[i] = &content.Text{Text: text}
+				continue
+			}
+		case *content.JSON:
+			data, n := r.redactJSON(item.Data)
+			if n > 0 {
+				total += n
+				redacted[i] = &content.JSON{Data: data}
+				continue
+			}
+		}
+		redacted[i] = item
+	}
+	return redacted, total
+}
+
+// redactJSON redacts the strings in a JSON value. Tools often put output in
+// JSON strings, where newlines are escaped, so the strings are redacted one by
+// one rather than the JSON as a whole.
+func (r *Redactor) redactJSON(data json.RawMessage) (json.RawMessage, int) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		text, n := r.Redact(string(data))
+		return json.RawMessage(text), n
+	}
+	total := 0
+	v = r.redactValue(v, &total)
+	if total == 0 {
+		return data, 0
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data, 0
+	}
+	return json.RawMessage(bytes.TrimSpace(buf.Bytes())), total
+}
+
+func (r *Redactor) redactValue(v any, total *int) any {
+	switch v := v.(type) {
+	case string:
+		s, n := r.Redact(v)
+		*total += n
+		return s
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item, total)
+		}
+	case map[string]any:
+		for key, item := range v {
+			// A key that holds a secret, as in {"apiKey": "..."}.
+			if s, ok := item.(string); ok && reSecretName.MatchString(key) && isSecretAssignment(key, s) {
+				*total++
+				v[key] = "[REDACTED secret]"
+				continue
+			}
+			v[key] = r.redactValue(item, total)
+		}
+	}
+	return v
+}
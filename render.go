@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/firstaid"
+)
+
+// turnView is the part of the writer that a turn is rendered to: text is
+// written to it, while thoughts and tool progress are shown as its task.
+type turnView interface {
+	io.Writer
+	SetTask(label string)
+	AppendTask(label string)
+}
+
+// turnRenderer renders the updates of a turn, keeping track of what was
+// written last so that text, thoughts and finished tools are separated
+// properly.
+type turnRenderer struct {
+	w             turnView
+	hasAddedText  bool
+	hasAddedTool  bool
+	thinkingStart time.Time
+	// Tools may run in parallel, so show what all of them are doing.
+	running toolStatuses
+}
+
+func newTurnRenderer(w turnView) *turnRenderer {
+	return &turnRenderer{w: w}
+}
+
+func (r *turnRenderer) render(update llms.Update) {
+	w := r.w
+	switch update := update.(type) {
+	case llms.ThinkingUpdate:
+		if r.hasAddedTool {
+			fmt.Fprint(w, "\n")
+			r.hasAddedTool = false
+		}
+		w.AppendTask(update.Text)
+		if r.thinkingStart.IsZero() {
+			r.thinkingStart = time.Now()
+		}
+	case llms.TextUpdate:
+		if r.hasAddedTool {
+			fmt.Fprint(w, "\n\n")
+			r.hasAddedTool = false
+		} else if !r.thinkingStart.IsZero() {
+			w.SetTask("")
+			fmt.Fprintf(w, "💭 Thought for %.1f seconds\n\n", time.Since(r.thinkingStart).Seconds())
+		}
+		r.thinkingStart = time.Time{}
+		if !r.hasAddedText {
+			text := strings.TrimLeftFunc(update.Text, unicode.IsSpace)
+			if text != "" {
+				fmt.Fprint(w, text)
+				r.hasAddedText = true
+			}
+		} else {
+			fmt.Fprint(w, update.Text)
+			r.hasAddedText = true
+		}
+	case llms.ToolStartUpdate:
+		if r.hasAddedText {
+			fmt.Fprint(w, "\n\n")
+		}
+		r.thinkingStart = time.Time{}
+		r.running.set(update.ToolCallID, update.Tool.Label())
+		w.SetTask(r.running.String())
+		r.hasAddedText = false
+	case llms.ToolDeltaUpdate:
+		// We don't do anything with this yet.
+	case llms.ToolStatusUpdate:
+		r.running.set(update.ToolCallID, update.Status)
+		w.SetTask(r.running.String())
+	case llms.ToolDoneUpdate:
+		r.running.remove(update.ToolCallID)
+		w.SetTask(r.running.String())
+		if r.hasAddedTool {
+			fmt.Fprint(w, "\n")
+		}
+		r.hasAddedTool = true
+		if err := update.Result.Error(); err != nil {
+			fmt.Fprintf(w, "❌ %s: %s", update.Result.Label(), firstaid.FirstLineString(err.Error()))
+		} else {
+			fmt.Fprintf(w, "✅ %s", update.Result.Label())
+		}
+	default:
+		panic(fmt.Sprintf("unhandled update type: %q", update.Type()))
+	}
+}
+
+// renderError renders a message about an error that ended the turn.
+func (r *turnRenderer) renderError(message string) {
+	r.w.SetTask("")
+	if r.hasAddedText {
+		fmt.Fprint(r.w, "\n\n")
+	} else if r.hasAddedTool {
+		fmt.Fprint(r.w, "\n")
+	}
+	fmt.Fprintf(r.w, "❌ %s", message)
+}
+
+// toolStatuses keeps the status of each running tool call, in the order they
+// started.
+type toolStatuses struct {
+	ids      []string
+	statuses map[string]string
+}
+
+func (t *toolStatuses) set(id, status string) {
+	if t.statuses == nil {
+		t.statuses = make(map[string]string)
+	}
+	if _, ok := t.statuses[id]; !ok {
+		t.ids = append(t.ids, id)
+	}
+	t.statuses[id] = status
+}
+
+func (t *toolStatuses) remove(id string) {
+	delete(t.statuses, id)
+	t.ids = slices.DeleteFunc(t.ids, func(other string) bool { return other == id })
+}
+
+func (t *toolStatuses) String() string {
+	statuses := make([]string, len(t.ids))
+	for i, id := range t.ids {
+		statuses[i] = t.statuses[id]
+	}
+	return strings.Join(statuses, " · ")
+}
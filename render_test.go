@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-llms/llms"
+	"github.com/flitsinc/go-llms/tools"
+
+	"github.com/blixt/first-aid/agent"
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/audit"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/firstaid"
+	"github.com/blixt/first-aid/llmtest"
+	"github.com/blixt/first-aid/session"
+)
+
+// fakeView records what a turn renders.
+type fakeView struct {
+	strings.Builder
+	tasks []string
+}
+
+func (v *fakeView) SetTask(label string) {
+	v.tasks = append(v.tasks, label)
+}
+
+func (v *fakeView) AppendTask(label string) {
+	v.tasks = append(v.tasks, "+"+label)
+}
+
+// thoughtDuration matches the part of the output that changes between runs.
+var thoughtDuration = regexp.MustCompile(`Thought for [0-9.]+ seconds`)
+
+func output(v *fakeView) string {
+	return thoughtDuration.ReplaceAllString(v.String(), "Thought for N seconds")
+}
+
+type echoParams struct {
+	Text string `json:"text"`
+}
+
+var echoTool = tools.Func("Echo", "Echo the text", "echo", func(r tools.Runner, p echoParams) tools.Result {
+	if p.Text == "" {
+		return tools.ErrorWithLabel("Echo", errors.New("nothing to echo\nmore details"))
+	}
+	r.Report("Echoing " + p.Text)
+	return tools.SuccessWithLabel("Echo "+p.Text, map[string]string{"text": p.Text})
+})
+
+func TestRenderParallelTools(t *testing.T) {
+	v := &fakeView{}
+	r := newTurnRenderer(v)
+	for _, update := range []llms.Update{
+		llms.TextUpdate{Text: "\n  Looking."},
+		llms.ToolStartUpdate{ToolCallID: "1", Tool: echoTool},
+		llms.ToolStartUpdate{ToolCallID: "2", Tool: echoTool},
+		llms.ToolDeltaUpdate{ToolCallID: "2", Delta: json.RawMessage(`{}`)},
+		llms.ToolStatusUpdate{ToolCallID: "2", Status: "Echoing b", Tool: echoTool},
+		llms.ToolDoneUpdate{ToolCallID: "1", Result: tools.SuccessWithLabel("Echo a", nil), Tool: echoTool},
+		llms.ToolDoneUpdate{ToolCallID: "2", Result: tools.ErrorWithLabel("Echo b", errors.New("failed\nbadly")), Tool: echoTool},
+		llms.TextUpdate{Text: "Done"},
+		llms.TextUpdate{Text: "."},
+	} {
+		r.render(update)
+	}
+
+	if want := "Looking.\n\n✅ Echo a\n❌ Echo b: `failed` (+1 line)\n\nDone."; v.String() != want {
+		t.Errorf("expected output %q, got %q", want, v.String())
+	}
+	wantTasks := []string{"Echo", "Echo · Echo", "Echo · Echoing b", "Echoing b", ""}
+	if strings.Join(v.tasks, "|") != strings.Join(wantTasks, "|") {
+		t.Errorf("expected tasks %q, got %q", wantTasks, v.tasks)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	v := &fakeView{}
+	r := newTurnRenderer(v)
+	r.render(llms.ToolStartUpdate{ToolCallID: "1", Tool: echoTool})
+	r.render(llms.ToolDoneUpdate{ToolCallID: "1", Result: tools.SuccessWithLabel("Echo a", nil), Tool: echoTool})
+	r.renderError("Oops")
+	if want := "✅ Echo a\n❌ Oops"; v.String() != want {
+		t.Errorf("expected output %q, got %q", want, v.String())
+	}
+}
+
+// newTestApp creates an app with the default config that talks to provider
+// and saves its session in a temporary directory.
+func newTestApp(t *testing.T, provider llms.Provider, toolList ...tools.Tool) *app {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("FIRST_AID_DATA_DIR", dir)
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"maxRetries": 0}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := config.Load([]string{"--config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := session.NewStore(filepath.Join(dir, "sessions"))
+	return newApp(cfg, agent.New(provider, toolList...), approval.NewGate(&approval.Policy{}), store, session.New())
+}
+
+func runTurn(a *app, input string) *fakeView {
+	v := &fakeView{}
+	r := newTurnRenderer(v)
+	for update := range a.chat(context.Background(), input) {
+		r.render(update)
+	}
+	if err := a.err(); err != nil {
+		r.renderError(providerErrorMessage(err))
+	}
+	return v
+}
+
+func TestChatWithTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := json.Marshal(firstaid.ListFilesParams{Path: dir})
+	provider := llmtest.NewProvider(t,
+		llmtest.Response{
+			llmtest.Thinking("Where could they be?"),
+			llmtest.Text("Let me look."),
+			llmtest.ToolCall("list_files", string(args)),
+			llmtest.ToolCall("echo", `{"text": "hi"}`),
+			llmtest.ToolCall("echo", `{}`),
+		},
+		llmtest.Response{
+			llmtest.ExpectToolResult("list_files", "notes.txt"),
+			llmtest.Text("They're in notes.txt."),
+		},
+	)
+	a := newTestApp(t, provider, firstaid.ListFiles, echoTool)
+
+	v := runTurn(a, "where are my notes?")
+	if err := a.err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "💭 Thought for N seconds\n\nLet me look.\n\n✅ List files in `" + dir + "`\n✅ Echo hi\n❌ Echo: `nothing to echo` (+1 line)\n\nThey're in notes.txt."
+	if got := output(v); got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	if !strings.HasPrefix(v.tasks[0], "+Where could they be?") {
+		t.Errorf("expected the thought to be shown as a task, got %q", v.tasks)
+	}
+
+	saved, err := a.store.Load(a.sess.ID)
+	if err != nil {
+		t.Fatalf("expected the session to be saved: %v", err)
+	}
+	if saved.Title != "where are my notes?" || len(saved.Messages) == 0 {
+		t.Errorf("expected the session to have a title and messages, got %+v", saved)
+	}
+
+	calls, err := audit.NewLog(a.cfg.AuditLog).Query(audit.Filter{Session: a.sess.ID}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	failed := 0
+	for _, call := range calls {
+		if call.Error != "" {
+			failed++
+		}
+	}
+	if len(calls) != 3 || failed != 1 {
+		t.Errorf("expected the tool calls to be in the audit log, got %+v", calls)
+	}
+}
+
+func TestChatProviderError(t *testing.T) {
+	provider := llmtest.NewProvider(t,
+		llmtest.Response{
+			llmtest.Text("Well"),
+			llmtest.Error(errors.New("400 Bad Request")),
+		},
+		llmtest.Response{
+			llmtest.Text("Hello again."),
+		},
+	)
+	a := newTestApp(t, provider)
+
+	v := runTurn(a, "hi")
+	if want := "Well\n\n❌ The provider refused to cooperate: 400 Bad Request"; v.String() != want {
+		t.Errorf("expected output %q, got %q", want, v.String())
+	}
+
+	// The next turn starts over from the last complete response.
+	v = runTurn(a, "hi again")
+	if want := "Hello again."; v.String() != want {
+		t.Errorf("expected output %q, got %q", want, v.String())
+	}
+	requests := provider.Requests()
+	if n := len(requests[1].Messages); n != 1 {
+		t.Errorf("expected the failed turn to be dropped from the history, got %d messages", n)
+	}
+}
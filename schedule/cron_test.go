@@ -0,0 +1,47 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blixt/first-aid/schedule"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2025, 7, 9, 14, 30, 20, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 7, 9, 14, 31, 0, 0, time.UTC)},
+		{"0 14 * * *", time.Date(2025, 7, 10, 14, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 7, 9, 14, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 7, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2025, 7, 13, 9, 0, 0, 0, time.UTC)},
+		{"30 8 1,15 * *", time.Date(2025, 7, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 7, 9, 15, 0, 0, 0, time.UTC)},
+		// Restricting both days means either one matches.
+		{"0 12 1 * 5", time.Date(2025, 7, 11, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		c, err := schedule.ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.expr, err)
+			continue
+		}
+		if got := c.Next(now); !got.Equal(test.want) {
+			t.Errorf("%q: expected %s, got %s", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := schedule.ParseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package schedule keeps tasks that first-aid should run later, either once or
+// repeatedly, in a JSON file. The tasks are run by `first-aid daemon`.
+package schedule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is a task to run as a turn of a new first-aid session.
+type Job struct {
+	ID   string `json:"id"`
+	Task string `json:"task"`
+	// Cwd is the directory the task runs in.
+	Cwd string `json:"cwd"`
+	// Cron is the cron expression of a recurring job. One-shot jobs don't
+	// have one, and are removed once they've run, unless they failed.
+	Cron string `json:"cron,omitempty"`
+	// Next is when the job runs next. It's zero for one-shot jobs that
+	// failed, which are kept until they're canceled so that the failure
+	// can be seen.
+	Next time.Time `json:"next"`
+	// Speak makes the daemon read the result out loud.
+	Speak   bool      `json:"speak,omitempty"`
+	Created time.Time `json:"created"`
+
+	LastRun     time.Time `json:"lastRun,omitzero"`
+	LastSession string    `json:"lastSession,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Recurring reports whether the job runs more than once.
+func (j Job) Recurring() bool {
+	return j.Cron != ""
+}
+
+// When describes when the job runs next, after its cron expression if it
+// recurs.
+func (j Job) When() string {
+	if j.Next.IsZero() {
+		return "never again (the last run failed)"
+	}
+	next := j.Next.Local().Format("Mon Jan 2 15:04")
+	if j.Recurring() {
+		return fmt.Sprintf("%s (next: %s)", j.Cron, next)
+	}
+	return next
+}
+
+var ErrNotFound = errors.New("scheduled task not found")
+
+// Store keeps jobs in a JSON file. Every change reads the file again, so that
+// the daemon and interactive sessions can share it.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path returns the path of the file holding the jobs.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// NewJob creates a job (without adding it) that runs task in cwd, either once
+// at the time at or repeatedly as described by the cron expression.
+func NewJob(task, cwd string, at time.Time, cron string, now time.Time) (Job, error) {
+	task = strings.TrimSpace(task)
+	if task == "" {
+		return Job{}, fmt.Errorf("the task must not be empty")
+	}
+	job := Job{ID: newID(), Task: task, Cwd: cwd, Created: now}
+	switch {
+	case cron != "" && !at.IsZero():
+		return Job{}, fmt.Errorf("a task runs either once or on a schedule, not both")
+	case cron != "":
+		c, err := ParseCron(cron)
+		if err != nil {
+			return Job{}, err
+		}
+		job.Cron = strings.TrimSpace(cron)
+		job.Next = c.Next(now)
+		if job.Next.IsZero() {
+			return Job{}, fmt.Errorf("the cron expression %q never matches", cron)
+		}
+	case !at.IsZero():
+		if !at.After(now) {
+			return Job{}, fmt.Errorf("%s is in the past", at.Format(time.RFC1123))
+		}
+		job.Next = at
+	default:
+		return Job{}, fmt.Errorf("a time or a cron expression is required")
+	}
+	return job, nil
+}
+
+func newID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ParseTime parses a time given as RFC 3339 or as a local time like
+// "2025-07-09 08:00".
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use a format like \"2006-01-02 15:04\")", s)
+}
+
+func (s *Store) load() ([]Job, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return jobs, nil
+}
+
+func (s *Store) save(jobs []Job) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// update loads the jobs, applies fn and saves the result if fn succeeded.
+func (s *Store) update(fn func(jobs []Job) ([]Job, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	jobs, err = fn(jobs)
+	if err != nil {
+		return err
+	}
+	return s.save(jobs)
+}
+
+// List returns all jobs, the one that runs next first and the ones that
+// won't run again last.
+func (s *Store) List() ([]Job, error) {
+	s.mu.Lock()
+	jobs, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(jobs, func(a, b Job) int {
+		switch {
+		case a.Next.IsZero() && !b.Next.IsZero():
+			return 1
+		case !a.Next.IsZero() && b.Next.IsZero():
+			return -1
+		}
+		return a.Next.Compare(b.Next)
+	})
+	return jobs, nil
+}
+
+// Add adds a job created with NewJob.
+func (s *Store) Add(job Job) error {
+	return s.update(func(jobs []Job) ([]Job, error) {
+		return append(jobs, job), nil
+	})
+}
+
+// Cancel removes the job with the id.
+func (s *Store) Cancel(id string) (Job, error) {
+	var job Job
+	err := s.update(func(jobs []Job) ([]Job, error) {
+		i := slices.IndexFunc(jobs, func(j Job) bool { return j.ID == id })
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		job = jobs[i]
+		return slices.Delete(jobs, i, i+1), nil
+	})
+	return job, err
+}
+
+// Due returns the jobs that should have run by now, the oldest first.
+func (s *Store) Due(now time.Time) ([]Job, error) {
+	jobs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(jobs, func(j Job) bool { return j.Next.IsZero() || j.Next.After(now) }), nil
+}
+
+// Finish records that the job ran at the time ran. One-shot jobs are removed
+// if they succeeded and otherwise kept without a next run, and recurring jobs
+// are scheduled for the next matching time after now (runs that were missed
+// while the daemon wasn't running are skipped).
+func (s *Store) Finish(id string, ran, now time.Time, sessionID string, runErr error) error {
+	return s.update(func(jobs []Job) ([]Job, error) {
+		i := slices.IndexFunc(jobs, func(j Job) bool { return j.ID == id })
+		if i < 0 {
+			// The job was canceled while it ran.
+			return jobs, nil
+		}
+		job := &jobs[i]
+		if !job.Recurring() && runErr == nil {
+			return slices.Delete(jobs, i, i+1), nil
+		}
+		job.LastRun = ran
+		job.LastSession = sessionID
+		job.LastError = ""
+		if runErr != nil {
+			job.LastError = runErr.Error()
+		}
+		if !job.Recurring() {
+			job.Next = time.Time{}
+			return jobs, nil
+		}
+		c, err := ParseCron(job.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.ID, err)
+		}
+		job.Next = c.Next(now)
+		if job.Next.IsZero() {
+			return slices.Delete(jobs, i, i+1), nil
+		}
+		return jobs, nil
+	})
+}
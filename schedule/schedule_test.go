@@ -0,0 +1,135 @@
+package schedule_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blixt/first-aid/schedule"
+)
+
+func TestStore(t *testing.T) {
+	store := schedule.NewStore(filepath.Join(t.TempDir(), "schedule.json"))
+	now := time.Date(2025, 7, 9, 14, 30, 0, 0, time.Local)
+
+	once, err := schedule.NewJob("check the weather", "/tmp", now.Add(time.Hour), "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	daily, err := schedule.NewJob("clean up downloads", "/tmp", time.Time{}, "0 14 * * *", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, job := range []schedule.Job{daily, once} {
+		if err := store.Add(job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	jobs, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != once.ID {
+		t.Fatalf("expected the one-shot job first, got %+v", jobs)
+	}
+
+	due, err := store.Due(now.Add(2 * time.Hour))
+	if err != nil || len(due) != 1 || due[0].ID != once.ID {
+		t.Fatalf("expected only the one-shot job to be due, got %+v (%v)", due, err)
+	}
+
+	later := now.Add(24 * time.Hour)
+	if err := store.Finish(once.ID, later, later, "session-1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Finish(daily.ID, later, later, "session-2", errors.New("oops")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs, _ = store.List()
+	if len(jobs) != 1 || jobs[0].ID != daily.ID {
+		t.Fatalf("expected the one-shot job to be removed, got %+v", jobs)
+	}
+	if want := time.Date(2025, 7, 11, 14, 0, 0, 0, time.Local); !jobs[0].Next.Equal(want) {
+		t.Errorf("expected the next run at %s, got %s", want, jobs[0].Next)
+	}
+	if jobs[0].LastSession != "session-2" || jobs[0].LastError != "oops" {
+		t.Errorf("expected the last run to be recorded, got %+v", jobs[0])
+	}
+
+	if _, err := store.Cancel(daily.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Cancel(daily.ID); !errors.Is(err, schedule.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFinishFailedOneShot(t *testing.T) {
+	store := schedule.NewStore(filepath.Join(t.TempDir(), "schedule.json"))
+	now := time.Date(2025, 7, 9, 14, 30, 0, 0, time.Local)
+	once, err := schedule.NewJob("check the weather", "/tmp", now.Add(time.Hour), "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	later, err := schedule.NewJob("check again", "/tmp", now.Add(2*time.Hour), "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, job := range []schedule.Job{once, later} {
+		if err := store.Add(job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	ran := now.Add(time.Hour)
+	if err := store.Finish(once.ID, ran, ran, "session-1", errors.New("provider is down")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(jobs) != 2 || jobs[1].ID != once.ID {
+		t.Fatalf("expected the failed job to be kept last, got %+v", jobs)
+	}
+	if j := jobs[1]; j.LastError != "provider is down" || j.LastSession != "session-1" || !j.LastRun.Equal(ran) || !j.Next.IsZero() {
+		t.Errorf("expected the failure to be recorded without a next run, got %+v", j)
+	}
+	if due, err := store.Due(now.Add(24 * time.Hour)); err != nil || len(due) != 1 || due[0].ID != later.ID {
+		t.Errorf("expected the failed job not to run again, got %+v (%v)", due, err)
+	}
+	if _, err := store.Cancel(once.ID); err != nil {
+		t.Errorf("expected the failed job to be canceled, got %v", err)
+	}
+}
+
+func TestNewJobErrors(t *testing.T) {
+	now := time.Now()
+	if _, err := schedule.NewJob("", "/", now.Add(time.Hour), "", now); err == nil {
+		t.Error("expected an error for an empty task")
+	}
+	if _, err := schedule.NewJob("task", "/", now.Add(-time.Hour), "", now); err == nil {
+		t.Error("expected an error for a time in the past")
+	}
+	if _, err := schedule.NewJob("task", "/", now.Add(time.Hour), "@daily", now); err == nil {
+		t.Error("expected an error for both a time and a cron expression")
+	}
+	if _, err := schedule.NewJob("task", "/", time.Time{}, "", now); err == nil {
+		t.Error("expected an error for no time")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	got, err := schedule.ParseTime("2025-07-10 08:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2025, 7, 10, 8, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if _, err := schedule.ParseTime("tomorrow"); err == nil {
+		t.Error("expected an error")
+	}
+}
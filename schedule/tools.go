@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+type ScheduleTaskParams struct {
+	Task  string `json:"task" description:"What to do when the task runs, written as a complete prompt. The current conversation won't be available then, and no one will be around to answer questions."`
+	At    string `json:"at,omitempty" description:"When to run the task once, as a local time like \"2025-07-09 08:00\" or an RFC 3339 timestamp."`
+	Cron  string `json:"cron,omitempty" description:"When to run the task repeatedly, as a cron expression (minute hour day-of-month month day-of-week), e.g. \"0 14 * * *\" for every day at 2pm."`
+	Speak bool   `json:"speak,omitempty" description:"Read the result out loud once the task has run."`
+}
+
+type ListScheduledTasksParams struct{}
+
+type CancelScheduledTaskParams struct {
+	ID string `json:"id"`
+}
+
+// Tools returns the tools for scheduling tasks in the store.
+func (s *Store) Tools() []tools.Tool {
+	return []tools.Tool{
+		tools.Func(
+			"Schedule task",
+			"Schedule a task to run later, either once or repeatedly. Each run is a new conversation in the current directory, with the same tools. Tasks only run while `first-aid daemon` is running.",
+			"schedule_task",
+			func(r tools.Runner, p ScheduleTaskParams) tools.Result {
+				label := "Schedule task"
+				var at time.Time
+				if p.At != "" {
+					var err error
+					if at, err = ParseTime(p.At); err != nil {
+						return tools.ErrorWithLabel(label, err)
+					}
+				}
+				cwd, err := os.Getwd()
+				if err != nil {
+					return tools.ErrorWithLabel(label, err)
+				}
+				job, err := NewJob(p.Task, cwd, at, p.Cron, time.Now())
+				if err != nil {
+					return tools.ErrorWithLabel(label, err)
+				}
+				job.Speak = p.Speak
+				if err := s.Add(job); err != nil {
+					return tools.ErrorWithLabel(label, err)
+				}
+				return tools.SuccessWithLabel(fmt.Sprintf("Scheduled task %s for %s", job.ID, job.When()), job)
+			},
+		),
+		tools.Func(
+			"List scheduled tasks",
+			"List the tasks that are scheduled to run later, in all directories, and one-time tasks whose run failed.",
+			"list_scheduled_tasks",
+			func(r tools.Runner, p ListScheduledTasksParams) tools.Result {
+				jobs, err := s.List()
+				if err != nil {
+					return tools.ErrorWithLabel("List scheduled tasks", err)
+				}
+				if jobs == nil {
+					jobs = []Job{}
+				}
+				return tools.SuccessWithLabel(fmt.Sprintf("List scheduled tasks (%d)", len(jobs)), map[string]any{"tasks": jobs})
+			},
+		),
+		tools.Func(
+			"Cancel scheduled task",
+			"Cancel a scheduled task so that it doesn't run again.",
+			"cancel_scheduled_task",
+			func(r tools.Runner, p CancelScheduledTaskParams) tools.Result {
+				label := fmt.Sprintf("Cancel scheduled task %s", p.ID)
+				job, err := s.Cancel(p.ID)
+				if err != nil {
+					return tools.ErrorWithLabel(label, err)
+				}
+				return tools.SuccessWithLabel(label, job)
+			},
+		),
+	}
+}
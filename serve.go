@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/approval"
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/prompt"
+	"github.com/blixt/first-aid/server"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/usage"
+)
+
+// runServer serves the HTTP API until interrupted. Every session gets its own
+// agent, but they share the tools. There's no one to ask for approval, so
+// tools that need it only run if allowed by the policy or --yes.
+func runServer(cfg *config.Config, profile *prompt.Profile, model llms.Provider, store *session.Store, gate *approval.Gate) int {
+	token := cfg.ServeToken
+	if token == "" {
+		var b [16]byte
+		rand.Read(b[:])
+		token = hex.EncodeToString(b[:])
+		fmt.Fprintf(os.Stderr, "No serveToken configured, so this run uses the token %s\n", token)
+	}
+
+	toolList, cleanup := loadTools(cfg, gate.Policy)
+	defer cleanup()
+
+	s := &server.Server{
+		Token:    token,
+		Sessions: store,
+		Open: func(sess *session.Session) server.Conversation {
+			return serverConversation{newApp(cfg, newAgent(cfg, profile, model, toolList), gate, store, sess)}
+		},
+	}
+	httpServer := &http.Server{
+		Addr:              cfg.ServeAddr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", cfg.ServeAddr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// serverConversation lets the server chat in an app's session.
+type serverConversation struct {
+	a *app
+}
+
+var _ server.Conversation = serverConversation{}
+
+func (c serverConversation) Chat(ctx context.Context, input string) <-chan llms.Update {
+	return c.a.chat(ctx, input)
+}
+
+func (c serverConversation) Err() error {
+	return c.a.err()
+}
+
+func (c serverConversation) Usage() usage.Summary {
+	return c.a.usage.Summary()
+}
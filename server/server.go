@@ -0,0 +1,259 @@
+// Package server serves first-aid sessions over HTTP, so that it can be used
+// from scripts and other devices. Replies are streamed as Server-Sent Events
+// with the same events as the --json output.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/event"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/usage"
+)
+
+// Conversation is a session that messages can be sent to. It's expected to
+// save the session after every turn.
+type Conversation interface {
+	Chat(ctx context.Context, input string) <-chan llms.Update
+	// Err returns the error that ended the last turn, if any.
+	Err() error
+	Usage() usage.Summary
+}
+
+type Server struct {
+	// Token is the bearer token that every request must have.
+	Token    string
+	Sessions *session.Store
+	// Open returns a conversation for a session, which is either new or was
+	// loaded from the store.
+	Open func(sess *session.Session) Conversation
+	// IdleTimeout is how long a conversation is kept open after its last
+	// turn. Sessions are saved after every turn, so a session whose
+	// conversation was closed is opened again when it gets a message.
+	// Defaults to 30 minutes.
+	IdleTimeout time.Duration
+
+	mu            sync.Mutex
+	conversations map[string]*conversation
+}
+
+type conversation struct {
+	Conversation
+	busy     bool
+	lastUsed time.Time
+}
+
+const defaultIdleTimeout = 30 * time.Minute
+
+// keepAliveInterval is how often a comment is sent on idle event streams, to
+// stop proxies from closing them.
+const keepAliveInterval = 15 * time.Second
+
+// Handler returns the HTTP handler for the API and the web UI. The UI itself
+// is public, but it needs the token to use the API.
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/sessions", s.listSessions)
+	api.HandleFunc("POST /api/sessions", s.createSession)
+	api.HandleFunc("GET /api/sessions/{id}", s.getSession)
+	api.HandleFunc("POST /api/sessions/{id}/messages", s.sendMessage)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	mux.Handle("/", webHandler())
+	return mux
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	infos, err := s.Sessions.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if infos == nil {
+		infos = []session.Info{}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	sess := session.New()
+	if err := s.Sessions.Save(sess); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.mu.Lock()
+	s.addConversation(sess)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, sess)
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	sess, err := s.Sessions.Load(r.PathValue("id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sess)
+}
+
+type messageRequest struct {
+	Message string `json:"message"`
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("the message must not be empty"))
+		return
+	}
+	conv, err := s.acquire(r.PathValue("id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	defer s.release(conv)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The turn is canceled if the client goes away.
+	updates := conv.Chat(r.Context(), req.Message)
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+loop:
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				break loop
+			}
+			if e, ok := event.FromUpdate(update); ok {
+				writeEvent(w, e)
+				flusher.Flush()
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+	if err := conv.Err(); err != nil && r.Context().Err() == nil {
+		writeEvent(w, event.FromError(err))
+	}
+	writeEvent(w, event.FromUsage(conv.Usage()))
+	writeEvent(w, event.Event{Type: event.TypeDone})
+	flusher.Flush()
+}
+
+var errBusy = errors.New("the session is busy with another message")
+
+// acquire returns the conversation for the session, opening it if needed, and
+// marks it as busy so that only one turn runs at a time.
+func (s *Server) acquire(id string) (*conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conv := s.conversations[id]
+	if conv == nil {
+		// The id may be a prefix, so only trust the loaded session's id.
+		sess, err := s.Sessions.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		if conv = s.conversations[sess.ID]; conv == nil {
+			conv = s.addConversation(sess)
+		}
+	}
+	if conv.busy {
+		return nil, errBusy
+	}
+	conv.busy = true
+	return conv, nil
+}
+
+func (s *Server) release(conv *conversation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conv.busy = false
+	conv.lastUsed = time.Now()
+}
+
+// addConversation opens a conversation for the session, closing the ones
+// that have been idle for too long. It must be called with s.mu held.
+func (s *Server) addConversation(sess *session.Session) *conversation {
+	if s.conversations == nil {
+		s.conversations = make(map[string]*conversation)
+	}
+	timeout := s.IdleTimeout
+	if timeout <= 0 {
+		timeout = defaultIdleTimeout
+	}
+	now := time.Now()
+	for id, conv := range s.conversations {
+		if !conv.busy && now.Sub(conv.lastUsed) > timeout {
+			delete(s.conversations, id)
+		}
+	}
+	conv := &conversation{Conversation: s.Open(sess), lastUsed: now}
+	s.conversations[sess.ID] = conv
+	return conv
+}
+
+func writeEvent(w http.ResponseWriter, e event.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errBusy):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,221 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/event"
+	"github.com/blixt/first-aid/server"
+	"github.com/blixt/first-aid/session"
+	"github.com/blixt/first-aid/usage"
+)
+
+// echo is a conversation that repeats what it's told.
+type echo struct {
+	store *session.Store
+	sess  *session.Session
+	turns int
+	block chan struct{}
+}
+
+func (e *echo) Chat(ctx context.Context, input string) <-chan llms.Update {
+	updates := make(chan llms.Update)
+	go func() {
+		defer close(updates)
+		if e.block != nil {
+			<-e.block
+		}
+		e.turns++
+		e.sess.SetTitle(input)
+		updates <- llms.TextUpdate{Text: "You said: "}
+		updates <- llms.TextUpdate{Text: input}
+		e.store.Save(e.sess)
+	}()
+	return updates
+}
+
+func (e *echo) Err() error { return nil }
+
+func (e *echo) Usage() usage.Summary {
+	return usage.Summary{Session: usage.Tokens{Input: e.turns}}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, map[string]*echo) {
+	t.Helper()
+	return newTestServerWithTimeout(t, 0)
+}
+
+func newTestServerWithTimeout(t *testing.T, idleTimeout time.Duration) (*httptest.Server, map[string]*echo) {
+	t.Helper()
+	store := session.NewStore(t.TempDir())
+	convs := make(map[string]*echo)
+	s := &server.Server{
+		Token:    "secret",
+		Sessions: store,
+		Open: func(sess *session.Session) server.Conversation {
+			e := &echo{store: store, sess: sess}
+			convs[sess.ID] = e
+			return e
+		},
+		IdleTimeout: idleTimeout,
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, convs
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func readEvents(t *testing.T, resp *http.Response) []event.Event {
+	t.Helper()
+	var events []event.Event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e event.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, header := range []string{"", "Bearer wrong", "secret"} {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/sessions", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected 401 for %q, got %d", header, resp.StatusCode)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ts, convs := newTestServer(t)
+
+	resp := request(t, ts, "POST", "/api/sessions", "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var created session.Session
+	json.NewDecoder(resp.Body).Decode(&created)
+
+	resp = request(t, ts, "POST", "/api/sessions/"+created.ID+"/messages", `{"message":"hello"}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	events := readEvents(t, resp)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if strings.Join(types, ",") != "text,text,usage,done" {
+		t.Fatalf("unexpected events %v", types)
+	}
+	if events[1].Text != "hello" || events[2].Usage.Session.Input != 1 {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	// Continuing the session uses the same conversation.
+	readEvents(t, request(t, ts, "POST", "/api/sessions/"+created.ID+"/messages", `{"message":"again"}`))
+	if len(convs) != 1 || convs[created.ID].turns != 2 {
+		t.Errorf("expected two turns in one conversation, got %d conversations", len(convs))
+	}
+
+	resp = request(t, ts, "GET", "/api/sessions", "")
+	var infos []session.Info
+	json.NewDecoder(resp.Body).Decode(&infos)
+	if len(infos) != 1 || infos[0].Title != "hello" {
+		t.Errorf("unexpected sessions %+v", infos)
+	}
+
+	if resp := request(t, ts, "GET", "/api/sessions/nope", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+	if resp := request(t, ts, "POST", "/api/sessions/"+created.ID+"/messages", `{"message":" "}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty message, got %d", resp.StatusCode)
+	}
+}
+
+func TestBusySession(t *testing.T) {
+	ts, convs := newTestServer(t)
+	var created session.Session
+	json.NewDecoder(request(t, ts, "POST", "/api/sessions", "").Body).Decode(&created)
+	conv := convs[created.ID]
+	conv.block = make(chan struct{})
+
+	first := request(t, ts, "POST", "/api/sessions/"+created.ID+"/messages", `{"message":"one"}`)
+	if resp := request(t, ts, "POST", "/api/sessions/"+created.ID+"/messages", `{"message":"two"}`); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 while busy, got %d", resp.StatusCode)
+	}
+	close(conv.block)
+	if events := readEvents(t, first); len(events) != 4 {
+		t.Errorf("expected the first message to finish, got %+v", events)
+	}
+}
+
+func TestIdleConversations(t *testing.T) {
+	ts, convs := newTestServerWithTimeout(t, 50*time.Millisecond)
+	var first, second session.Session
+	json.NewDecoder(request(t, ts, "POST", "/api/sessions", "").Body).Decode(&first)
+	readEvents(t, request(t, ts, "POST", "/api/sessions/"+first.ID+"/messages", `{"message":"hello"}`))
+	opened := convs[first.ID]
+
+	// Opening another conversation closes the idle one.
+	time.Sleep(100 * time.Millisecond)
+	json.NewDecoder(request(t, ts, "POST", "/api/sessions", "").Body).Decode(&second)
+	events := readEvents(t, request(t, ts, "POST", "/api/sessions/"+first.ID+"/messages", `{"message":"again"}`))
+	if convs[first.ID] == opened {
+		t.Fatal("expected the idle conversation to be opened again")
+	}
+	if len(events) != 4 || events[1].Text != "again" || convs[first.ID].sess.Title != "hello" {
+		t.Errorf("expected the saved session to be continued, got %+v", events)
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, path := range []string{"/", "/app.js", "/style.css"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %s to be served without a token, got %d", path, resp.StatusCode)
+		}
+	}
+}
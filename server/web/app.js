@@ -0,0 +1,327 @@
+// The chat UI for `first-aid serve`. It talks to the same API as any other
+// client, streaming replies as Server-Sent Events over fetch.
+
+const state = {
+  token: localStorage.getItem("first-aid-token") || "",
+  sessionId: null,
+  busy: false,
+};
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+function firstLine(s) {
+  return s.trim().split("\n")[0];
+}
+
+class AuthError extends Error {}
+
+async function api(method, path, body) {
+  const res = await fetch(path, {
+    method,
+    headers: {
+      Authorization: `Bearer ${state.token}`,
+      "Content-Type": "application/json",
+    },
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (res.status === 401) throw new AuthError("Invalid token");
+  if (!res.ok) {
+    const data = await res.json().catch(() => ({}));
+    throw new Error(data.error || `Request failed (${res.status})`);
+  }
+  return res;
+}
+
+function showLogin(error) {
+  $("app").hidden = true;
+  $("login").hidden = false;
+  $("login-error").textContent = error || "";
+  $("token").focus();
+}
+
+async function start() {
+  try {
+    await loadSessions();
+  } catch (err) {
+    showLogin(err instanceof AuthError && state.token ? err.message : "");
+    return;
+  }
+  $("login").hidden = true;
+  $("app").hidden = false;
+  $("input").focus();
+}
+
+async function loadSessions() {
+  const res = await api("GET", "/api/sessions");
+  const sessions = await res.json();
+  const list = $("sessions");
+  list.replaceChildren();
+  for (const info of sessions) {
+    const item = el("li", info.id === state.sessionId ? "active" : "");
+    item.append(el("span", "", info.title || "Untitled"));
+    item.append(el("small", "", `${new Date(info.updated).toLocaleString()} · ${info.cwd}`));
+    item.onclick = () => openSession(info.id);
+    list.append(item);
+  }
+}
+
+async function openSession(id) {
+  if (state.busy) return;
+  const res = await api("GET", `/api/sessions/${encodeURIComponent(id)}`);
+  const session = await res.json();
+  state.sessionId = session.id;
+  renderHistory(session.messages || []);
+  await loadSessions();
+}
+
+// Content items are rendered leniently, since they're stored in the
+// provider library's own format.
+function contentItems(content) {
+  if (typeof content === "string") return [{ text: content }];
+  if (!Array.isArray(content)) return [];
+  const items = [];
+  for (const item of content) {
+    const url = item.image_url?.url || item.imageUrl?.url || item.url;
+    if (typeof item.text === "string" && item.type !== "thought" && item.type !== "thinking") {
+      items.push({ text: item.text });
+    } else if (typeof url === "string") {
+      items.push({ image: url });
+    }
+  }
+  return items;
+}
+
+function renderHistory(messages) {
+  const container = $("messages");
+  container.replaceChildren();
+  let assistant = null;
+  for (const message of messages) {
+    const toolCallId = message.tool_call_id || message.toolCallId;
+    const toolCalls = message.tool_calls || message.toolCalls || [];
+    if (message.role === "user" && !toolCallId) {
+      addUserMessage(contentItems(message.content).map((i) => i.text || "").join("\n"));
+      assistant = null;
+      continue;
+    }
+    if (!assistant) assistant = new AssistantMessage();
+    for (const item of contentItems(message.content)) {
+      if (toolCallId) {
+        if (item.image) assistant.images([item.image]);
+      } else if (item.text) {
+        assistant.text(item.text);
+      }
+    }
+    for (const call of toolCalls) {
+      assistant.toolStart(call.id, call.name);
+      assistant.toolDone(call.id, call.name);
+    }
+  }
+  container.scrollTop = container.scrollHeight;
+}
+
+function addUserMessage(text) {
+  const node = el("div", "message user text", text);
+  $("messages").append(node);
+}
+
+// AssistantMessage renders one reply as its events come in.
+class AssistantMessage {
+  constructor() {
+    this.node = el("div", "message assistant");
+    this.tools = new Map();
+    this.thinking = null;
+    this.thinkingStart = 0;
+    this.current = null;
+    $("messages").append(this.node);
+  }
+
+  append(child) {
+    this.node.append(child);
+    const container = $("messages");
+    if (container.scrollHeight - container.scrollTop - container.clientHeight < 200) {
+      container.scrollTop = container.scrollHeight;
+    }
+  }
+
+  endThinking() {
+    if (!this.thinking) return;
+    const seconds = ((Date.now() - this.thinkingStart) / 1000).toFixed(1);
+    this.thinking.querySelector("summary").textContent = `💭 Thought for ${seconds} seconds`;
+    this.thinking = null;
+  }
+
+  think(text) {
+    if (!this.thinking) {
+      this.thinking = el("details", "thinking");
+      this.thinking.append(el("summary", "", "💭 Thinking…"), el("div"));
+      this.thinkingStart = Date.now();
+      this.current = null;
+      this.append(this.thinking);
+    }
+    this.thinking.querySelector("div").textContent += text;
+  }
+
+  text(text) {
+    this.endThinking();
+    if (!this.current) {
+      text = text.trimStart();
+      if (!text) return;
+      this.current = el("div", "text");
+      this.append(this.current);
+    }
+    this.current.textContent += text;
+  }
+
+  toolStart(id, label) {
+    this.endThinking();
+    this.current = null;
+    const badge = el("div", "tool", `⏳ ${label}`);
+    this.tools.set(id, badge);
+    this.append(badge);
+  }
+
+  toolStatus(id, status) {
+    const badge = this.tools.get(id);
+    if (badge) badge.textContent = `⏳ ${status}`;
+  }
+
+  toolDone(id, label, error) {
+    let badge = this.tools.get(id);
+    if (!badge) {
+      badge = el("div", "tool");
+      this.append(badge);
+    }
+    if (error) {
+      badge.className = "tool failed";
+      badge.textContent = `❌ ${label}: ${firstLine(error)}`;
+      badge.title = error;
+    } else {
+      badge.className = "tool done";
+      badge.textContent = `✅ ${label}`;
+    }
+  }
+
+  images(urls) {
+    const container = el("div", "images");
+    for (const url of urls) {
+      const img = el("img");
+      img.src = url;
+      img.alt = "Image returned by a tool";
+      container.append(img);
+    }
+    this.current = null;
+    this.append(container);
+  }
+
+  error(message) {
+    this.endThinking();
+    this.current = null;
+    this.append(el("div", "error", `❌ ${firstLine(message)}`));
+  }
+
+  usage(usage) {
+    const turn = usage.turn;
+    let line = `${turn.input} in · ${turn.output} out`;
+    if (turn.thinking) line += ` · ~${turn.thinking} thinking`;
+    if (usage.priceKnown) line += ` · $${usage.turnCost.toFixed(4)} this turn · $${usage.sessionCost.toFixed(2)} this session`;
+    if (usage.budgetExceeded) line += " · over budget";
+    this.append(el("div", "usage", line));
+  }
+
+  handle(event) {
+    switch (event.type) {
+      case "thinking": this.think(event.text || ""); break;
+      case "text": this.text(event.text || ""); break;
+      case "tool_start": this.toolStart(event.toolCallId, event.label || event.tool); break;
+      case "tool_status": this.toolStatus(event.toolCallId, event.status); break;
+      case "tool_done":
+        this.toolDone(event.toolCallId, event.label || event.tool, event.error);
+        if (event.images) this.images(event.images);
+        break;
+      case "error": this.error(event.error); break;
+      case "usage": this.usage(event.usage); break;
+    }
+  }
+}
+
+async function send(message) {
+  if (!state.sessionId) {
+    const res = await api("POST", "/api/sessions");
+    state.sessionId = (await res.json()).id;
+    $("messages").replaceChildren();
+  }
+  addUserMessage(message);
+  const reply = new AssistantMessage();
+  try {
+    const res = await api("POST", `/api/sessions/${encodeURIComponent(state.sessionId)}/messages`, { message });
+    const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = "";
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buffer += value;
+      let end;
+      while ((end = buffer.indexOf("\n\n")) >= 0) {
+        const chunk = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+        for (const line of chunk.split("\n")) {
+          if (line.startsWith("data: ")) reply.handle(JSON.parse(line.slice(6)));
+        }
+      }
+    }
+  } catch (err) {
+    if (err instanceof AuthError) {
+      showLogin(err.message);
+      return;
+    }
+    reply.error(err.message);
+  }
+  reply.endThinking();
+}
+
+$("login").onsubmit = (e) => {
+  e.preventDefault();
+  state.token = $("token").value.trim();
+  localStorage.setItem("first-aid-token", state.token);
+  start();
+};
+
+$("new-session").onclick = () => {
+  if (state.busy) return;
+  state.sessionId = null;
+  $("messages").replaceChildren();
+  loadSessions();
+  $("input").focus();
+};
+
+$("composer").onsubmit = async (e) => {
+  e.preventDefault();
+  const message = $("input").value.trim();
+  if (!message || state.busy) return;
+  $("input").value = "";
+  state.busy = true;
+  $("send").disabled = true;
+  try {
+    await send(message);
+  } finally {
+    state.busy = false;
+    $("send").disabled = false;
+    loadSessions().catch(() => {});
+  }
+};
+
+$("input").onkeydown = (e) => {
+  if (e.key === "Enter" && !e.shiftKey) {
+    e.preventDefault();
+    $("composer").requestSubmit();
+  }
+};
+
+start();
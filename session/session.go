@@ -0,0 +1,189 @@
+// Package session persists conversations so that they can be resumed later.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/llms"
+
+	"github.com/blixt/first-aid/usage"
+)
+
+type Session struct {
+	ID       string         `json:"id"`
+	Created  time.Time      `json:"created"`
+	Updated  time.Time      `json:"updated"`
+	Cwd      string         `json:"cwd"`
+	Title    string         `json:"title"`
+	Messages []llms.Message `json:"messages"`
+	// Usage is the total number of tokens used in the session, and Cost its
+	// estimated cost in USD.
+	Usage usage.Tokens `json:"usage"`
+	Cost  float64      `json:"cost,omitempty"`
+}
+
+// Info is the metadata of a session, without its messages.
+type Info struct {
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Cwd      string    `json:"cwd"`
+	Title    string    `json:"title"`
+	Messages int       `json:"messages"`
+}
+
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps sessions as JSON files in a directory.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// New creates a session (without saving it) for the current directory.
+func New() *Session {
+	cwd, _ := os.Getwd()
+	now := time.Now()
+	return &Session{
+		ID:      newID(now),
+		Created: now,
+		Updated: now,
+		Cwd:     cwd,
+	}
+}
+
+func newID(t time.Time) string {
+	var b [2]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%s-%s", t.Format("20060102-150405"), hex.EncodeToString(b[:]))
+}
+
+// SetTitle sets the title of the session unless it already has one.
+func (s *Session) SetTitle(input string) {
+	if s.Title != "" {
+		return
+	}
+	title := strings.Join(strings.Fields(input), " ")
+	if runes := []rune(title); len(runes) > 60 {
+		title = string(runes[:59]) + "…"
+	}
+	s.Title = title
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save writes the session to disk, replacing any previous version.
+func (s *Store) Save(sess *Session) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	sess.Updated = time.Now()
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(sess.ID))
+}
+
+// Load reads the session with the given id. A unique prefix of an id is also
+// accepted.
+func (s *Store) Load(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\*?[`) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		matches, _ := filepath.Glob(s.path(id + "*"))
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("session id %q is ambiguous", id)
+		} else if len(matches) == 0 {
+			return nil, ErrNotFound
+		}
+		data, err = os.ReadFile(matches[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess := &Session{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return sess, nil
+}
+
+// List returns the metadata of all sessions, most recently updated first.
+func (s *Store) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var infos []Info
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		sess, err := s.Load(id)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, Info{
+			ID:       sess.ID,
+			Created:  sess.Created,
+			Updated:  sess.Updated,
+			Cwd:      sess.Cwd,
+			Title:    sess.Title,
+			Messages: len(sess.Messages),
+		})
+	}
+	slices.SortFunc(infos, func(a, b Info) int {
+		return b.Updated.Compare(a.Updated)
+	})
+	return infos, nil
+}
+
+// Latest returns the most recently updated session started in cwd, or the
+// most recently updated session overall if there is none for cwd.
+func (s *Store) Latest(cwd string) (*Session, error) {
+	infos, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, ErrNotFound
+	}
+	for _, info := range infos {
+		if info.Cwd == cwd {
+			return s.Load(info.ID)
+		}
+	}
+	return s.Load(infos[0].ID)
+}
@@ -0,0 +1,71 @@
+package session_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blixt/first-aid/session"
+)
+
+func TestSaveLoadList(t *testing.T) {
+	store := session.NewStore(t.TempDir())
+
+	first := session.New()
+	first.SetTitle("why is   my\ndisk full?")
+	first.SetTitle("this should not replace the title")
+	if err := store.Save(first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	second := session.New()
+	second.Cwd = "/somewhere/else"
+	if err := store.Save(second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := store.Load(first.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Title != "why is my disk full?" {
+		t.Errorf("unexpected title %q", loaded.Title)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(infos) != 2 || infos[0].ID != second.ID || infos[1].ID != first.ID {
+		t.Fatalf("expected sessions ordered by most recent update, got %+v", infos)
+	}
+
+	latest, err := store.Latest(first.Cwd)
+	if err != nil || latest.ID != first.ID {
+		t.Errorf("expected latest session for cwd to be %s, got %v (%v)", first.ID, latest, err)
+	}
+	latest, err = store.Latest("/nowhere")
+	if err != nil || latest.ID != second.ID {
+		t.Errorf("expected fallback to most recent session %s, got %v (%v)", second.ID, latest, err)
+	}
+}
+
+func TestLoadPrefix(t *testing.T) {
+	store := session.NewStore(t.TempDir())
+	sess := session.New()
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := store.Load(sess.ID[len(sess.ID)-4:])
+	if !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("expected suffix to not match, got %v (%v)", loaded, err)
+	}
+	loaded, err = store.Load(sess.ID[:15])
+	if err != nil || loaded.ID != sess.ID {
+		t.Errorf("expected prefix to match %s, got %v (%v)", sess.ID, loaded, err)
+	}
+	if _, err := store.Load("../" + sess.ID); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("expected path traversal to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/session"
+)
+
+// sessionStore returns the store that sessions are saved in.
+func sessionStore() *session.Store {
+	return session.NewStore(filepath.Join(config.DataDir(), "sessions"))
+}
+
+// openSession returns the session to use for this run: a new one, the one
+// asked for with --resume, or the latest one in this directory with
+// --continue.
+func openSession(store *session.Store, cfg *config.Config) (*session.Session, error) {
+	switch {
+	case cfg.Resume != "":
+		sess, err := store.Load(cfg.Resume)
+		if errors.Is(err, session.ErrNotFound) {
+			return nil, fmt.Errorf("there's no session %q to resume (see `first-aid sessions`)", cfg.Resume)
+		}
+		return sess, err
+	case cfg.Continue:
+		cwd, _ := os.Getwd()
+		sess, err := store.Latest(cwd)
+		if errors.Is(err, session.ErrNotFound) {
+			return nil, fmt.Errorf("there's no session to continue in this directory (see `first-aid sessions`)")
+		}
+		return sess, err
+	default:
+		return session.New(), nil
+	}
+}
+
+// listSessions prints the saved sessions and returns the exit code.
+func listSessions(store *session.Store) int {
+	infos, err := store.List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(infos) == 0 {
+		fmt.Println("No sessions yet.")
+		return 0
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUPDATED\tMESSAGES\tDIRECTORY\tTITLE")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", info.ID, info.Updated.Format(time.DateTime), info.Messages, info.Cwd, info.Title)
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/session"
+)
+
+func TestOpenSession(t *testing.T) {
+	store := session.NewStore(filepath.Join(t.TempDir(), "sessions"))
+	saved := session.New()
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := openSession(store, &config.Config{Resume: saved.ID})
+	if err != nil || sess.ID != saved.ID {
+		t.Fatalf("expected session %s, got %v: %v", saved.ID, sess, err)
+	}
+	sess, err = openSession(store, &config.Config{Continue: true})
+	if err != nil || sess.ID != saved.ID {
+		t.Fatalf("expected the latest session %s, got %v: %v", saved.ID, sess, err)
+	}
+	if _, err := openSession(store, &config.Config{Resume: saved.ID + "x"}); err == nil {
+		t.Error("expected an error for a session id with a typo")
+	}
+	sess, err = openSession(store, &config.Config{})
+	if err != nil || sess.ID == saved.ID {
+		t.Errorf("expected a new session, got %v: %v", sess, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/blixt/first-aid/config"
+	"github.com/blixt/first-aid/terminal"
+)
+
+// terminalLog is the log of commands that the shell hooks write to and the
+// recent_terminal_history tool reads.
+var terminalLog = sync.OnceValue(func() *terminal.Log {
+	return terminal.NewLog(filepath.Join(config.DataDir(), "terminal.jsonl"))
+})
+
+// typescriptsDir is where shells that capture output keep their typescripts.
+func typescriptsDir() string {
+	return filepath.Join(config.DataDir(), "typescripts")
+}
+
+// runShellInit prints the hooks for a shell, for the user to eval in their
+// shell's rc file.
+func runShellInit(args []string) int {
+	fs := flag.NewFlagSet("shell-init", flag.ContinueOnError)
+	capture := fs.Bool("capture-output", false, "Also record the end of each command's output (runs the shell inside script(1))")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: first-aid shell-init [--capture-output] bash|zsh")
+		fs.PrintDefaults()
+	}
+	// Allow the shell to come before the flag too.
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	script, err := terminal.HookScript(fs.Arg(0), exe, typescriptsDir(), *capture)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	terminal.RemoveOldTypescripts(typescriptsDir())
+	fmt.Print(script)
+	return 0
+}
+
+// runShellRecord adds a command to the terminal log. It's run by the shell
+// hooks after every command.
+func runShellRecord(args []string) int {
+	fs := flag.NewFlagSet("shell-record", flag.ContinueOnError)
+	exit := fs.Int("exit", 0, "Exit code of the command")
+	cwd := fs.String("cwd", "", "Directory the command ran in")
+	shell := fs.Int("shell", 0, "Process ID of the shell")
+	typescript := fs.String("typescript", "", "Typescript of the shell, to read the command's output from")
+	offset := fs.Int64("offset", -1, "Size of the typescript when the command started")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	e := terminal.Entry{
+		Time:    time.Now(),
+		Command: fs.Arg(0),
+		Exit:    *exit,
+		Cwd:     *cwd,
+		Shell:   *shell,
+	}
+	if e.Command == "" {
+		return 0
+	}
+	if *typescript != "" {
+		e.Output = terminal.ReadOutput(*typescript, *offset)
+	}
+	if err := terminalLog().Append(e); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package terminal
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Shells are the shells that there are hooks for.
+var Shells = []string{"bash", "zsh"}
+
+// typescriptMaxAge is how long typescripts of shells that are probably gone
+// are kept around.
+const typescriptMaxAge = 7 * 24 * time.Hour
+
+//go:embed hooks
+var hooks embed.FS
+
+var hookTemplates = template.Must(template.ParseFS(hooks, "hooks/*"))
+
+// HookScript returns the script that installs the hooks for the shell. The
+// hooks run exe to record each command. With capture, shells also run inside
+// script(1), writing their typescripts to dir, so that the end of each
+// command's output can be recorded.
+func HookScript(shell, exe, dir string, capture bool) (string, error) {
+	name := map[string]string{"bash": "bash.sh", "zsh": "zsh.zsh"}[shell]
+	if name == "" {
+		return "", fmt.Errorf("unsupported shell %q (supported shells: %s)", shell, strings.Join(Shells, ", "))
+	}
+	var sb strings.Builder
+	err := hookTemplates.ExecuteTemplate(&sb, name, map[string]any{
+		"Exe":     quote(exe),
+		"Dir":     quote(dir),
+		"Capture": capture,
+	})
+	return sb.String(), err
+}
+
+// quote quotes s for bash and zsh.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// RemoveOldTypescripts removes the typescripts in dir that haven't been
+// written to in a week, since their shells have most likely exited.
+func RemoveOldTypescripts(dir string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.typescript"))
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > typescriptMaxAge {
+			os.Remove(path)
+		}
+	}
+}
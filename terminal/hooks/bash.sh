@@ -0,0 +1,66 @@
+# first-aid shell hooks for bash. Add this to ~/.bashrc:
+#   eval "$(first-aid shell-init bash)"
+if [[ $- == *i* ]]; then
+{{- if .Capture}}
+  # Run the shell inside script(1) so that the output of commands can be
+  # recorded too. Shells in other terminals (e.g. tmux panes) get their own.
+  if [[ -n $FIRST_AID_TYPESCRIPT && -z $FIRST_AID_TYPESCRIPT_TTY ]]; then
+    export FIRST_AID_TYPESCRIPT_TTY=$(tty)
+  fi
+  if [[ $FIRST_AID_TYPESCRIPT_TTY != "$(tty)" ]]; then
+    unset FIRST_AID_TYPESCRIPT FIRST_AID_TYPESCRIPT_TTY
+    if command -v script >/dev/null 2>&1; then
+      mkdir -p {{.Dir}}
+      export FIRST_AID_TYPESCRIPT={{.Dir}}/$$.typescript
+      if [[ $(uname) == Darwin ]]; then
+        exec script -q -F "$FIRST_AID_TYPESCRIPT"
+      else
+        exec script -q -f "$FIRST_AID_TYPESCRIPT"
+      fi
+    fi
+  fi
+{{- end}}
+
+  __first_aid_precmd() {
+    local exit_status=$? entry number command
+    entry=$(HISTTIMEFORMAT= builtin history 1)
+    if [[ $entry =~ ^\ *([0-9]+)\*?\ +(.*)$ ]]; then
+      number=${BASH_REMATCH[1]} command=${BASH_REMATCH[2]}
+    fi
+    # The history file is loaded after .bashrc, so the first prompt only
+    # notes where the history is at.
+    if [[ -z ${__first_aid_last+set} ]]; then
+      __first_aid_last=$number
+      return
+    fi
+    # The history number only changes when a command was run.
+    [[ -n $number && $number != "$__first_aid_last" ]] || return
+    __first_aid_last=$number
+{{- if .Capture}}
+    if [[ -n $FIRST_AID_TYPESCRIPT && -n $__first_aid_offset ]]; then
+      {{.Exe}} shell-record --exit "$exit_status" --cwd "$PWD" --shell $$ \
+        --typescript "$FIRST_AID_TYPESCRIPT" --offset "$__first_aid_offset" -- "$command" >/dev/null 2>&1
+      __first_aid_offset=
+      return
+    fi
+{{- end}}
+    ({{.Exe}} shell-record --exit "$exit_status" --cwd "$PWD" --shell $$ -- "$command" >/dev/null 2>&1 &)
+  }
+  PROMPT_COMMAND="__first_aid_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+{{- if .Capture}}
+
+  # Note where the output of each command starts, right before it runs.
+  if [[ -n $FIRST_AID_TYPESCRIPT ]]; then
+    __first_aid_arm() {
+      __first_aid_at_prompt=1
+    }
+    __first_aid_preexec() {
+      [[ -n $__first_aid_at_prompt ]] || return
+      __first_aid_at_prompt=
+      __first_aid_offset=$(($(wc -c 2>/dev/null <"$FIRST_AID_TYPESCRIPT" || echo -1)))
+    }
+    PROMPT_COMMAND="$PROMPT_COMMAND;__first_aid_arm"
+    trap '__first_aid_preexec' DEBUG
+  fi
+{{- end}}
+fi
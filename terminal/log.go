@@ -0,0 +1,88 @@
+// Package terminal keeps a log of the commands run in the user's shells, as
+// reported by the hooks from `first-aid shell-init`, so that the model can
+// see what the user just ran and why it failed.
+package terminal
+
+import (
+	"os"
+	"slices"
+	"time"
+
+	"github.com/blixt/first-aid/jsonl"
+)
+
+const (
+	// maxLogSize is the size at which the log is trimmed down to its last
+	// keptEntries entries.
+	maxLogSize  = 1 << 20
+	keptEntries = 250
+)
+
+// Entry is a command the user ran.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Exit    int       `json:"exit"`
+	Cwd     string    `json:"cwd"`
+	// Shell is the process ID of the shell the command ran in.
+	Shell int `json:"shell,omitempty"`
+	// Output is the end of what the command printed, if the shell captures
+	// output.
+	Output string `json:"output,omitempty"`
+}
+
+// Log is a ring log of commands, stored as JSON lines.
+type Log struct {
+	path string
+}
+
+// NewLog returns the log stored at path. The file is created when the first
+// command is added.
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the path of the log file.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append adds a command to the log, dropping the oldest ones if it has grown
+// too big. Shells append concurrently, so a command that's appended while
+// the log is being trimmed may be lost.
+func (l *Log) Append(e Entry) error {
+	if err := jsonl.Append(l.path, e); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(l.path); err != nil || fi.Size() <= maxLogSize {
+		return err
+	}
+	return l.trim()
+}
+
+func (l *Log) trim() error {
+	entries, err := jsonl.ReadAll[Entry](l.path)
+	if err != nil {
+		return err
+	}
+	return jsonl.Write(l.path, entries[max(len(entries)-keptEntries, 0):])
+}
+
+// Recent returns up to n of the most recent commands, oldest first. If shell
+// isn't 0, only commands from that shell are included.
+func (l *Log) Recent(n, shell int, failedOnly bool) ([]Entry, error) {
+	entries, err := jsonl.ReadAll[Entry](l.path)
+	if err != nil {
+		return nil, err
+	}
+	var recent []Entry
+	for i := len(entries) - 1; i >= 0 && len(recent) < n; i-- {
+		e := entries[i]
+		if (shell != 0 && e.Shell != shell) || (failedOnly && e.Exit == 0) {
+			continue
+		}
+		recent = append(recent, e)
+	}
+	slices.Reverse(recent)
+	return recent, nil
+}
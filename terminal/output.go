@@ -0,0 +1,118 @@
+package terminal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOutputLines and maxOutputBytes limit how much of a command's output
+	// is kept in the log.
+	maxOutputLines = 40
+	maxOutputBytes = 4000
+	// maxOutputRead is how much of the end of a typescript is read at most.
+	maxOutputRead = 64 << 10
+)
+
+// reEscape matches terminal escape sequences: CSI sequences (colors, cursor
+// movement), OSC sequences (window titles) and two byte escapes.
+var reEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-_]`)
+
+// ReadOutput returns the end of what was written to the typescript (as made
+// by script(1)) from offset onwards, cleaned up to look like it did in the
+// terminal. offset is the size of the typescript when the command started.
+func ReadOutput(typescript string, offset int64) string {
+	f, err := os.Open(typescript)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// script(1) writes the output after the shell gets to see it, so wait a
+	// moment for it to stop growing.
+	var size int64
+	for range 10 {
+		fi, err := f.Stat()
+		if err != nil {
+			return ""
+		}
+		if fi.Size() == size {
+			break
+		}
+		size = fi.Size()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if offset < 0 || offset >= size {
+		return ""
+	}
+
+	start := max(offset, size-maxOutputRead)
+	data := make([]byte, size-start)
+	if _, err := f.ReadAt(data, start); err != nil && err != io.EOF {
+		return ""
+	}
+	text := string(data)
+	// The offset may be in the middle of the line with the command, if the
+	// terminal hadn't finished echoing it.
+	if start > offset || !atLineStart(f, start) {
+		_, text, _ = strings.Cut(text, "\n")
+	}
+	text = CleanOutput(text, maxOutputLines)
+	if len(text) > maxOutputBytes {
+		text = text[len(text)-maxOutputBytes:]
+		// Don't start in the middle of a line (or a UTF-8 sequence).
+		if _, rest, ok := strings.Cut(text, "\n"); ok {
+			text = rest
+		}
+	}
+	return text
+}
+
+// atLineStart reports whether nothing but escape sequences and carriage
+// returns come between the last newline before offset and offset.
+func atLineStart(f *os.File, offset int64) bool {
+	from := max(offset-256, 0)
+	b := make([]byte, offset-from)
+	if _, err := f.ReadAt(b, from); err != nil {
+		return false
+	}
+	i := bytes.LastIndexByte(b, '\n')
+	if i < 0 && from > 0 {
+		return false
+	}
+	line := reEscape.ReplaceAll(b[i+1:], nil)
+	return len(bytes.Trim(line, "\r")) == 0
+}
+
+// CleanOutput removes escape sequences from what a command printed in a
+// terminal, applies carriage returns and backspaces the way the terminal
+// would (roughly), and keeps the last maxLines lines.
+func CleanOutput(text string, maxLines int) string {
+	text = reEscape.ReplaceAllString(text, "")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		// Progress bars redraw the line after a carriage return.
+		if j := strings.LastIndexByte(line, '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		if strings.ContainsRune(line, '\b') {
+			var b []rune
+			for _, r := range line {
+				if r == '\b' {
+					b = b[:max(len(b)-1, 0)]
+				} else {
+					b = append(b, r)
+				}
+			}
+			line = string(b)
+		}
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	lines = strings.Split(strings.Trim(strings.Join(lines, "\n"), "\n"), "\n")
+	return strings.Join(lines[max(len(lines)-maxLines, 0):], "\n")
+}
@@ -0,0 +1,145 @@
+package terminal_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blixt/first-aid/terminal"
+)
+
+func TestLog(t *testing.T) {
+	log := terminal.NewLog(filepath.Join(t.TempDir(), "terminal.jsonl"))
+	entries, err := log.Recent(10, 0, false)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty log, got %v, %v", entries, err)
+	}
+
+	now := time.Now()
+	for i, exit := range []int{0, 1, 0, 127} {
+		e := terminal.Entry{Time: now, Command: fmt.Sprintf("cmd %d", i), Exit: exit, Cwd: "/tmp", Shell: 100 + i%2}
+		if err := log.Append(e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	commands := func(entries []terminal.Entry) string {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Command)
+		}
+		return strings.Join(names, ", ")
+	}
+	tests := []struct {
+		n, shell   int
+		failedOnly bool
+		want       string
+	}{
+		{10, 0, false, "cmd 0, cmd 1, cmd 2, cmd 3"},
+		{2, 0, false, "cmd 2, cmd 3"},
+		{10, 100, false, "cmd 0, cmd 2"},
+		{10, 0, true, "cmd 1, cmd 3"},
+		{10, 101, true, "cmd 1, cmd 3"},
+		{10, 102, false, ""},
+	}
+	for _, tt := range tests {
+		entries, err := log.Recent(tt.n, tt.shell, tt.failedOnly)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := commands(entries); got != tt.want {
+			t.Errorf("Recent(%d, %d, %v) = %q, want %q", tt.n, tt.shell, tt.failedOnly, got, tt.want)
+		}
+	}
+}
+
+func TestLogTrim(t *testing.T) {
+	log := terminal.NewLog(filepath.Join(t.TempDir(), "terminal.jsonl"))
+	output := strings.Repeat("x", 3000)
+	for i := range 400 {
+		if err := log.Append(terminal.Entry{Command: fmt.Sprintf("cmd %d", i), Output: output}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	entries, err := log.Recent(1000, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) >= 400 || entries[len(entries)-1].Command != "cmd 399" {
+		t.Errorf("expected the oldest commands to be dropped, got %d ending with %q", len(entries), entries[len(entries)-1].Command)
+	}
+	if fi, err := os.Stat(log.Path()); err != nil || fi.Size() > 1<<20 {
+		t.Errorf("expected the log to stay small, got %v, %v", fi.Size(), err)
+	}
+}
+
+func TestReadOutput(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{"line start", "$ make\r\n", "\x1b[31merror\x1b[0m: oops\r\n", "error: oops"},
+		{"escapes before", "$ make\r\n\x1b[?2004l\r", "a\r\nb\r\n", "a\nb"},
+		{"unfinished echo", "$ ma", "ke\r\nfailed\r\n", "failed"},
+		{"progress", "$ curl\r\n", " 10%\r 50%\r100%\r\ndone\r\n", "100%\ndone"},
+		{"backspace", "$ x\r\n", "abd\bc\r\n", "abc"},
+		{"no output", "$ true\r\n", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "typescript")
+			if err := os.WriteFile(path, []byte(tt.before+tt.after), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if got := terminal.ReadOutput(path, int64(len(tt.before))); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "typescript")
+	var sb strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&sb, "line %d\r\n", i)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(terminal.ReadOutput(path, 0), "\n")
+	if len(lines) != 40 || lines[39] != "line 99" {
+		t.Errorf("expected the last 40 lines, got %d ending with %q", len(lines), lines[len(lines)-1])
+	}
+	if got := terminal.ReadOutput(path, 1<<20); got != "" {
+		t.Errorf("expected nothing for an offset past the end, got %q", got)
+	}
+}
+
+func TestHookScript(t *testing.T) {
+	if _, err := terminal.HookScript("fish", "/bin/first-aid", "/tmp", false); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+	for _, shell := range terminal.Shells {
+		for _, capture := range []bool{false, true} {
+			script, err := terminal.HookScript(shell, "/opt/it's here/first-aid", "/tmp/typescripts", capture)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", shell, err)
+			}
+			if !strings.Contains(script, `'/opt/it'\''s here/first-aid' shell-record`) {
+				t.Errorf("%s: expected the quoted executable in the script:\n%s", shell, script)
+			}
+			if got := strings.Contains(script, "exec script"); got != capture {
+				t.Errorf("%s: expected capture to be %v, got %v", shell, capture, got)
+			}
+			if _, err := exec.LookPath(shell); err != nil {
+				continue
+			}
+			if out, err := exec.Command(shell, "-n", "-c", script).CombinedOutput(); err != nil {
+				t.Errorf("%s: syntax error: %v\n%s", shell, err, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flitsinc/go-llms/tools"
+)
+
+type RecentTerminalHistoryParams struct {
+	Count        int  `json:"count,omitempty" description:"How many commands to return, counting back from the most recent one (default 10)."`
+	FailedOnly   bool `json:"failed_only,omitempty" description:"Only return commands that exited with a non-zero code."`
+	AllTerminals bool `json:"all_terminals,omitempty" description:"Include commands from the user's other terminals, not just the one first-aid is running in."`
+}
+
+// Tool returns a tool that lets the model read the most recent commands in
+// the log.
+func (l *Log) Tool() tools.Tool {
+	return tools.Func(
+		"Recent terminal history",
+		"Get the commands the user recently ran in their terminal, with their exit codes, directories and (if the user's shell captures it) the end of their output. Use this when the user asks about a command that just failed or about something they just did.",
+		"recent_terminal_history",
+		func(r tools.Runner, p RecentTerminalHistoryParams) tools.Result {
+			label := "Read recent terminal history"
+			if p.Count <= 0 {
+				p.Count = 10
+			}
+			if _, err := os.Stat(l.path); errors.Is(err, os.ErrNotExist) {
+				return tools.ErrorWithLabel(label, errors.New("no commands have been recorded, the user needs to set up the shell hooks with `first-aid shell-init bash|zsh` (see the README)"))
+			}
+			// When first-aid is run from a shell with the hooks, that shell is
+			// its parent.
+			shell := os.Getppid()
+			if p.AllTerminals {
+				shell = 0
+			}
+			entries, err := l.Recent(p.Count, shell, p.FailedOnly)
+			if err == nil && len(entries) == 0 && shell != 0 {
+				entries, err = l.Recent(p.Count, 0, p.FailedOnly)
+			}
+			if err != nil {
+				return tools.ErrorWithLabel(label, err)
+			}
+			if len(entries) == 0 {
+				return tools.SuccessWithLabel(label, map[string]any{"commands": []string{}})
+			}
+			return tools.SuccessWithLabel(fmt.Sprintf("%s (%d %s)", label, len(entries), plural(len(entries), "command")), map[string]any{
+				"commands": describe(entries, time.Now()),
+			})
+		},
+	)
+}
+
+// describe formats the entries for the model.
+func describe(entries []Entry, now time.Time) []string {
+	var lines []string
+	for _, e := range entries {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "$ %s\n(exit code %d, in %s, %s ago)", e.Command, e.Exit, e.Cwd, now.Sub(e.Time).Round(time.Second))
+		if e.Output != "" {
+			fmt.Fprintf(&sb, "\nEnd of the output:\n%s", e.Output)
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,230 @@
+// Package usage keeps track of the tokens used by a conversation and what
+// they cost.
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Tokens counts the tokens used by one or more requests. Thinking tokens are
+// estimated from the length of the thinking text, and are already included in
+// Output (providers bill thinking as output).
+type Tokens struct {
+	Input       int `json:"input"`
+	CachedInput int `json:"cachedInput,omitempty"`
+	Output      int `json:"output"`
+	Thinking    int `json:"thinking,omitempty"`
+}
+
+func (t Tokens) Add(other Tokens) Tokens {
+	return Tokens{
+		Input:       t.Input + other.Input,
+		CachedInput: t.CachedInput + other.CachedInput,
+		Output:      t.Output + other.Output,
+		Thinking:    t.Thinking + other.Thinking,
+	}
+}
+
+// Price is what a model costs, in USD per million tokens.
+type Price struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cachedInput,omitempty"`
+	Output      float64 `json:"output"`
+}
+
+// Cost returns the cost of the tokens in USD. Cached input tokens are counted
+// as part of Input, but charged at the CachedInput price.
+func (p Price) Cost(t Tokens) float64 {
+	uncached := max(t.Input-t.CachedInput, 0)
+	return (float64(uncached)*p.Input + float64(t.CachedInput)*p.CachedInput + float64(t.Output)*p.Output) / 1_000_000
+}
+
+// Prices maps "provider/model" (or just "model") to the model's price.
+type Prices map[string]Price
+
+// DefaultPrices are the list prices of some common models at the time of
+// writing. They can be overridden and extended in the config.
+var DefaultPrices = Prices{
+	"anthropic/claude-opus-4-20250514":   {Input: 15, CachedInput: 1.5, Output: 75},
+	"anthropic/claude-sonnet-4-20250514": {Input: 3, CachedInput: 0.3, Output: 15},
+	"anthropic/claude-3-7-sonnet-latest": {Input: 3, CachedInput: 0.3, Output: 15},
+	"anthropic/claude-3-5-haiku-latest":  {Input: 0.8, CachedInput: 0.08, Output: 4},
+	"openai/gpt-4o":                      {Input: 2.5, CachedInput: 1.25, Output: 10},
+	"openai/gpt-4o-mini":                 {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+	"openai/gpt-4.1":                     {Input: 2, CachedInput: 0.5, Output: 8},
+	"openai/o3":                          {Input: 2, CachedInput: 0.5, Output: 8},
+	"google/gemini-1.5-pro-001":          {Input: 1.25, CachedInput: 0.3125, Output: 5},
+	"google/gemini-2.5-pro":              {Input: 1.25, CachedInput: 0.31, Output: 10},
+	"google/gemini-2.5-flash":            {Input: 0.3, CachedInput: 0.075, Output: 2.5},
+}
+
+// Lookup returns the price of the model, preferring "provider/model" over
+// "model" keys.
+func (p Prices) Lookup(provider, model string) (Price, bool) {
+	if price, ok := p[strings.ToLower(provider)+"/"+model]; ok {
+		return price, true
+	}
+	price, ok := p[model]
+	return price, ok
+}
+
+// Merge returns the prices with the overrides applied on top.
+func (p Prices) Merge(overrides Prices) Prices {
+	merged := make(Prices, len(p)+len(overrides))
+	for k, v := range p {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+const (
+	BudgetWarn = "warn"
+	BudgetStop = "stop"
+)
+
+// Budget limits how much a session may cost.
+type Budget struct {
+	// MaxUSD is the maximum cost of a session. Zero means no limit.
+	MaxUSD float64 `json:"maxUSD,omitempty"`
+	// Action is BudgetWarn (the default) to only warn when the budget is
+	// exceeded, or BudgetStop to stop the conversation.
+	Action string `json:"action,omitempty"`
+}
+
+// Summary is a snapshot of the usage of the current turn and the session.
+type Summary struct {
+	Turn           Tokens  `json:"turn"`
+	Session        Tokens  `json:"session"`
+	TurnCost       float64 `json:"turnCost"`
+	SessionCost    float64 `json:"sessionCost"`
+	PriceKnown     bool    `json:"priceKnown"`
+	BudgetExceeded bool    `json:"budgetExceeded,omitempty"`
+}
+
+// Tracker accumulates usage for a session, one turn at a time. It's safe for
+// concurrent use.
+type Tracker struct {
+	Budget Budget
+
+	mu          sync.Mutex
+	price       Price
+	priceKnown  bool
+	turn        Tokens
+	turnCost    float64
+	session     Tokens
+	sessionCost float64
+}
+
+// NewTracker creates a tracker that continues from a session's previous
+// totals.
+func NewTracker(session Tokens, sessionCost float64) *Tracker {
+	return &Tracker{session: session, sessionCost: sessionCost}
+}
+
+// SetPrice sets the price of the model used from now on. If known is false,
+// costs aren't tracked until a known price is set.
+func (t *Tracker) SetPrice(price Price, known bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.price, t.priceKnown = price, known
+}
+
+// Reset starts over from nothing, as for a new session, keeping the price
+// and the budget.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turn, t.session = Tokens{}, Tokens{}
+	t.turnCost, t.sessionCost = 0, 0
+}
+
+// StartTurn resets the turn's counters.
+func (t *Tracker) StartTurn() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turn = Tokens{}
+	t.turnCost = 0
+}
+
+// Add records tokens used in the current turn.
+func (t *Tracker) Add(tokens Tokens) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turn = t.turn.Add(tokens)
+	t.session = t.session.Add(tokens)
+	if t.priceKnown {
+		cost := t.price.Cost(tokens)
+		t.turnCost += cost
+		t.sessionCost += cost
+	}
+}
+
+// Summary returns the usage so far.
+func (t *Tracker) Summary() Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Summary{
+		Turn:           t.turn,
+		Session:        t.session,
+		TurnCost:       t.turnCost,
+		SessionCost:    t.sessionCost,
+		PriceKnown:     t.priceKnown,
+		BudgetExceeded: t.Budget.MaxUSD > 0 && t.sessionCost > t.Budget.MaxUSD,
+	}
+}
+
+// ShouldStop reports whether the budget is exceeded and says to stop.
+func (t *Tracker) ShouldStop() bool {
+	return t.Budget.Action == BudgetStop && t.Summary().BudgetExceeded
+}
+
+// String formats the summary as a one-line footer.
+func (s Summary) String() string {
+	parts := []string{
+		fmt.Sprintf("%s in", formatCount(s.Turn.Input)),
+		fmt.Sprintf("%s out", formatCount(s.Turn.Output)),
+	}
+	if s.Turn.Thinking > 0 {
+		parts = append(parts, fmt.Sprintf("~%s thinking", formatCount(s.Turn.Thinking)))
+	}
+	if s.PriceKnown {
+		parts = append(parts, fmt.Sprintf("%s this turn", formatUSD(s.TurnCost)), fmt.Sprintf("%s this session", formatUSD(s.SessionCost)))
+	} else {
+		parts = append(parts, fmt.Sprintf("%s in / %s out this session", formatCount(s.Session.Input), formatCount(s.Session.Output)))
+	}
+	line := strings.Join(parts, " · ")
+	if s.BudgetExceeded {
+		line += " · over budget"
+	}
+	return line
+}
+
+func formatCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 10_000:
+		return fmt.Sprintf("%.0fk", float64(n)/1_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+func formatUSD(v float64) string {
+	if v < 0.01 {
+		return fmt.Sprintf("$%.4f", v)
+	}
+	return fmt.Sprintf("$%.2f", v)
+}
+
+// EstimateTokens roughly estimates the number of tokens in text.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
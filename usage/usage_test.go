@@ -0,0 +1,76 @@
+package usage_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/blixt/first-aid/usage"
+)
+
+func TestPriceCost(t *testing.T) {
+	price := usage.Price{Input: 3, CachedInput: 0.3, Output: 15}
+	cost := price.Cost(usage.Tokens{Input: 1_000_000, CachedInput: 500_000, Output: 100_000})
+	// 500k uncached at $3/M, 500k cached at $0.30/M and 100k out at $15/M.
+	if want := 1.5 + 0.15 + 1.5; math.Abs(cost-want) > 1e-9 {
+		t.Errorf("expected $%.4f, got $%.4f", want, cost)
+	}
+}
+
+func TestPricesLookup(t *testing.T) {
+	prices := usage.DefaultPrices.Merge(usage.Prices{
+		"my-model":        {Input: 1, Output: 2},
+		"openai/my-model": {Input: 10, Output: 20},
+	})
+	if p, ok := prices.Lookup("openai", "my-model"); !ok || p.Input != 10 {
+		t.Errorf("expected provider specific price, got %+v (%v)", p, ok)
+	}
+	if p, ok := prices.Lookup("google", "my-model"); !ok || p.Input != 1 {
+		t.Errorf("expected model price, got %+v (%v)", p, ok)
+	}
+	if _, ok := prices.Lookup("google", "unknown"); ok {
+		t.Error("expected unknown model to have no price")
+	}
+	if _, ok := usage.DefaultPrices["my-model"]; ok {
+		t.Error("expected Merge to leave the defaults alone")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := usage.NewTracker(usage.Tokens{Input: 100, Output: 10}, 1)
+	tracker.Budget = usage.Budget{MaxUSD: 2, Action: usage.BudgetStop}
+	tracker.SetPrice(usage.Price{Input: 1_000_000, Output: 1_000_000}, true)
+
+	tracker.StartTurn()
+	tracker.Add(usage.Tokens{Input: 0, Output: 1, Thinking: 1})
+	s := tracker.Summary()
+	if s.Turn.Output != 1 || s.Session.Output != 11 || s.Session.Input != 100 {
+		t.Errorf("unexpected tokens %+v", s)
+	}
+	if s.TurnCost != 1 || s.SessionCost != 2 || s.BudgetExceeded || tracker.ShouldStop() {
+		t.Errorf("expected to be exactly at the budget, got %+v", s)
+	}
+
+	tracker.StartTurn()
+	tracker.Add(usage.Tokens{Input: 1})
+	s = tracker.Summary()
+	if s.Turn.Output != 0 || s.TurnCost != 1 || !s.BudgetExceeded || !tracker.ShouldStop() {
+		t.Errorf("expected a new turn over the budget, got %+v", s)
+	}
+
+	tracker.Reset()
+	tracker.Add(usage.Tokens{Output: 1})
+	s = tracker.Summary()
+	if s.Session != (usage.Tokens{Output: 1}) || s.SessionCost != 1 || !s.PriceKnown || tracker.ShouldStop() {
+		t.Errorf("expected to start over with the same price and budget, got %+v", s)
+	}
+}
+
+func TestTrackerUnknownPrice(t *testing.T) {
+	tracker := usage.NewTracker(usage.Tokens{}, 0)
+	tracker.Budget = usage.Budget{MaxUSD: 0.01, Action: usage.BudgetStop}
+	tracker.Add(usage.Tokens{Input: 1_000_000, Output: 1_000_000})
+	s := tracker.Summary()
+	if s.PriceKnown || s.SessionCost != 0 || tracker.ShouldStop() {
+		t.Errorf("expected no cost without a price, got %+v", s)
+	}
+}
@@ -20,6 +20,7 @@ const (
 	hideCursor = "\033[?25l"
 	showCursor = "\033[?25h"
 	greenColor = "\033[32m"
+	grayColor  = "\033[90m"
 	resetColor = "\033[0m"
 )
 
@@ -32,9 +33,18 @@ type writer struct {
 	wg     sync.WaitGroup
 	cond   *sync.Cond
 
+	// aborted is set when the writer was stopped before writing everything.
+	aborted bool
+
 	taskLabel    string
 	taskIndex    int
 	taskEndIndex int
+
+	// interrupt is a function waiting to take over the terminal.
+	interrupt func()
+
+	// footer is shown dimmed (and without animation) after the output.
+	footer string
 }
 
 const (
@@ -74,6 +84,13 @@ func New() *writer {
 	return r
 }
 
+// ResetTerminal restores the cursor and color that the writer changes while
+// it's running, for use when exiting abruptly.
+func ResetTerminal() {
+	fmt.Fprint(os.Stdout, resetColor)
+	fmt.Fprint(os.Stdout, showCursor)
+}
+
 func Write(message string) {
 	w := New()
 	fmt.Fprint(w, message)
@@ -106,10 +123,36 @@ func (w *writer) StartAndWait() {
 			w.mu.Lock()
 			// Keep rechecking the values until we have at least one character
 			// to output, a task to update, or we are done.
-			for w.index == len(w.stream) && !w.done && w.taskLabel == lastSeenTask && w.taskEndIndex == lastSeenTaskEndIndex {
+			for w.index == len(w.stream) && !w.done && w.taskLabel == lastSeenTask && w.taskEndIndex == lastSeenTaskEndIndex && w.interrupt == nil {
 				w.cond.Wait()
 			}
 
+			// Hand over the terminal if someone asked for it and we've caught up.
+			if w.interrupt != nil && w.index == len(w.stream) {
+				interrupt := w.interrupt
+				w.interrupt = nil
+				atTask := w.index == w.taskIndex
+				w.mu.Unlock()
+				if !didStopSpinner {
+					sp.Stop()
+					didStopSpinner = true
+				}
+				fmt.Fprint(w.w, resetColor)
+				fmt.Fprint(w.w, showCursor)
+				interrupt()
+				fmt.Fprint(w.w, hideCursor)
+				fmt.Fprint(w.w, greenColor)
+				// The interruption left the cursor on a new line, and the task
+				// at the current position (if any) needs to be shown again.
+				lineLength = 0
+				charsSinceSpace = charsSinceSpace[:0]
+				if atTask {
+					lastSeenTask = ""
+					lastSeenTaskEndIndex = -1
+				}
+				continue
+			}
+
 			// Check if we have written all the characters and are done.
 			if w.index == len(w.stream) && w.done {
 				w.mu.Unlock()
@@ -218,6 +261,12 @@ func (w *writer) StartAndWait() {
 	fmt.Fprint(w.w, resetColor)
 	fmt.Fprint(w.w, showCursor)
 	fmt.Fprintln(w.w)
+	w.mu.Lock()
+	footer, aborted := w.footer, w.aborted
+	w.mu.Unlock()
+	if footer != "" && !aborted {
+		fmt.Fprintf(w.w, "%s%s%s\n", grayColor, footer, resetColor)
+	}
 }
 
 func (w *writer) Write(p []byte) (n int, err error) {
@@ -234,6 +283,34 @@ func (w *writer) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// Interrupt waits for all pending output to be written, then pauses the
+// writer and calls fn, which may use the terminal freely (for example to ask
+// the user a question) as long as it leaves the cursor on a new line.
+func (w *writer) Interrupt(fn func()) {
+	w.mu.Lock()
+	if w.done {
+		w.mu.Unlock()
+		fn()
+		return
+	}
+	finished := make(chan struct{})
+	w.interrupt = func() {
+		defer close(finished)
+		fn()
+	}
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-finished
+}
+
+// SetFooter sets a line, such as token usage, to show once all the output
+// has been written. It's not shown if the writer is aborted.
+func (w *writer) SetFooter(footer string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.footer = footer
+}
+
 func (w *writer) Done() {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -241,9 +318,24 @@ func (w *writer) Done() {
 	w.cond.Broadcast()
 }
 
+// Abort stops the writer as soon as possible, dropping any output that hasn't
+// been written yet. Any further writes or tasks are ignored.
+func (w *writer) Abort() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stream = w.stream[:w.index]
+	w.taskLabel = ""
+	w.done = true
+	w.aborted = true
+	w.cond.Broadcast()
+}
+
 func (w *writer) AppendTask(label string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if w.aborted {
+		return
+	}
 	if w.done {
 		panic("Cannot append task after the writer is done")
 	}
@@ -264,6 +356,9 @@ func (w *writer) AppendTask(label string) {
 func (w *writer) SetTask(label string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if w.aborted {
+		return
+	}
 	if w.done {
 		panic("Cannot set task after the writer is done")
 	}